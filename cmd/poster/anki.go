@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+// ankiTSV is the Anki export format selectable with -format.
+const ankiTSV = "tsv"
+
+// writeAnkiTSV writes one note per verse: front "Verse <label>", back the
+// body. Fields are HTML (declared in the file header), so newlines become
+// <br> and tabs an entity, keeping every note on one tab-separated line.
+func writeAnkiTSV(w io.Writer, texts []*model.Text) error {
+	if _, err := io.WriteString(w, "#separator:tab\n#html:true\n"); err != nil {
+		return err
+	}
+	for _, t := range texts {
+		front := ankiField("Verse " + t.Label)
+		back := ankiField(strings.TrimSpace(t.Body))
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", front, back); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ankiField(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\n", "<br>")
+	return strings.ReplaceAll(s, "\t", "&#9;")
+}
+
+// exportAnki writes every verse to path in the given format.
+func exportAnki(ctx context.Context, db *DB, path, format string) error {
+	if format != ankiTSV {
+		return fmt.Errorf("anki format %q is not supported yet (want %s)", format, ankiTSV)
+	}
+	texts, err := allTexts(ctx, db)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeAnkiTSV(f, texts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
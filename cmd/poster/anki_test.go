@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+func TestWriteAnkiTSV(t *testing.T) {
+	texts := []*model.Text{
+		{Label: "1", Body: "All that we are\nis the result\tof what we have thought."},
+		{Label: "58–59", Body: " As on a heap of rubbish <cast> & thrown. "},
+	}
+	var buf bytes.Buffer
+	if err := writeAnkiTSV(&buf, texts); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := []string{
+		"#separator:tab",
+		"#html:true",
+		"Verse 1\tAll that we are<br>is the result&#9;of what we have thought.",
+		"Verse 58–59\tAs on a heap of rubbish &lt;cast&gt; &amp; thrown.",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	for _, l := range lines[2:] {
+		if strings.Count(l, "\t") != 1 {
+			t.Errorf("row should have exactly two fields: %q", l)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// loadCredentials reads a -credentials-file: a JSON object keyed by the X_*
+// env var names, e.g. {"X_CONSUMER_KEY": "…", "X_ACCESS_TOKEN": "…"}. The
+// file must not be readable by other users.
+func loadCredentials(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if perm := info.Mode().Perm(); perm&0o007 != 0 {
+		return nil, fmt.Errorf("credentials file %s is accessible to other users (mode %#o); chmod 600 it", path, perm)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var creds map[string]string
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return nil, fmt.Errorf("credentials file %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// credentialLookup returns a getenv-like function: the env var when set,
+// else the value from the credentials file at path (if any).
+func credentialLookup(path string) (func(string) string, error) {
+	if path == "" {
+		return os.Getenv, nil
+	}
+	creds, err := loadCredentials(path)
+	if err != nil {
+		return nil, err
+	}
+	return func(key string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return creds[key]
+	}, nil
+}
+
+// newXHTTPClientFromEnv returns the X API client configured from the X_* env
+// vars, falling back to -credentials-file.
+func newXHTTPClientFromEnv(cfg *config) (*http.Client, error) {
+	getenv, err := credentialLookup(cfg.credsFile)
+	if err != nil {
+		return nil, err
+	}
+	return newXHTTPClient(getenv, cfg.tokenStore)
+}
+
+// newXHTTPClient returns the X API client: OAuth2 when X_REFRESH_TOKEN is
+// set, otherwise OAuth1 from the consumer and access keys.
+func newXHTTPClient(getenv func(string) string, tokenStore string) (*http.Client, error) {
+	if rt := getenv("X_REFRESH_TOKEN"); rt != "" {
+		clientID := getenv("X_CLIENT_ID")
+		if clientID == "" {
+			return nil, errors.New("missing required env var: X_CLIENT_ID (for X_REFRESH_TOKEN)")
+		}
+		// X_OAUTH2_ACCESS_TOKEN may be empty: the first 401 refreshes it.
+		tok := oauth2Token{AccessToken: getenv("X_OAUTH2_ACCESS_TOKEN"), RefreshToken: rt}
+		return newOAuth2HTTPClient(clientID, getenv("X_CLIENT_SECRET"), tok, tokenStore)
+	}
+	keys := []string{"X_CONSUMER_KEY", "X_CONSUMER_SECRET", "X_ACCESS_TOKEN", "X_ACCESS_SECRET"}
+	for _, k := range keys {
+		if getenv(k) == "" {
+			return nil, fmt.Errorf("missing required env var: %s", k)
+		}
+	}
+	return newOAuth1HTTPClient(getenv(keys[0]), getenv(keys[1]), getenv(keys[2]), getenv(keys[3])), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+)
+
+func writeCredentials(t *testing.T, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "creds.json")
+	creds := `{"X_CONSUMER_KEY": "file-ck", "X_CONSUMER_SECRET": "file-cs", "X_ACCESS_TOKEN": "file-at", "X_ACCESS_SECRET": "file-as"}`
+	if err := os.WriteFile(path, []byte(creds), perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, perm); err != nil { // not subject to the umask
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCredentialsFile_PopulatesClient(t *testing.T) {
+	for _, k := range []string{"X_CONSUMER_KEY", "X_CONSUMER_SECRET", "X_ACCESS_TOKEN", "X_ACCESS_SECRET", "X_REFRESH_TOKEN"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("X_ACCESS_TOKEN", "env-at") // env wins over the file
+
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"data":{"id":"1","username":"dhammapada"}}`))
+	}))
+	defer srv.Close()
+
+	client, err := newXHTTPClientFromEnv(&config{credsFile: writeCredentials(t, 0o600)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport.(*oauth1.Transport).Base = rewriteTransport{base: http.DefaultTransport, target: srv.URL}
+	if _, err := verifyCredentials(client); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`oauth_consumer_key="file-ck"`, `oauth_token="env-at"`} {
+		if !strings.Contains(auth, want) {
+			t.Errorf("Authorization header lacks %s: %q", want, auth)
+		}
+	}
+}
+
+func TestCredentialsFile_RejectsOtherReadable(t *testing.T) {
+	_, err := credentialLookup(writeCredentials(t, 0o644))
+	if err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("expected a permissions error, got %v", err)
+	}
+}
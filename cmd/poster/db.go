@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Supported database/sql driver names.
+const (
+	driverSQLite   = "sqlite"
+	driverPostgres = "postgres"
+)
+
+// DB is the poster's handle on the database. Queries throughout the package
+// use "?" placeholders, portable SQL and {table} references; DB rewrites
+// placeholders for drivers that want another style and prefixes table names
+// (see query), so callers need not care which driver or prefix is in use.
+//
+// On SQLite, statements that fail because another process holds the database
+// lock (say, overlapping cron runs) are retried up to retries times.
+type DB struct {
+	*sql.DB
+	driver  string
+	prefix  string // table name prefix, from -table-prefix
+	retries int    // extra attempts on a busy/locked SQLite database
+	// missing names the optional texts columns and tables (see ensureSchema)
+	// the database lacks; nil means none are missing.
+	missing map[string]bool
+}
+
+// dbOptions tunes openDB; the zero value is the default.
+type dbOptions struct {
+	TablePrefix string // prepended to every table name, e.g. "dhp_"
+	Retries     int    // extra attempts when SQLite reports busy/locked
+	ReadOnly    bool   // SQLite: refuse all writes (the query_only pragma)
+}
+
+// sqliteBusyTimeout is how long SQLite itself waits on a lock (the
+// busy_timeout pragma) before reporting SQLITE_BUSY.
+const sqliteBusyTimeout = 5 * time.Second
+
+// dbDriver picks the driver for a DHAMMAPADA_DB value: postgres:// and
+// postgresql:// URLs open Postgres, anything else is a SQLite file path.
+func dbDriver(dsn string) string {
+	lower := strings.ToLower(dsn)
+	if strings.HasPrefix(lower, "postgres://") || strings.HasPrefix(lower, "postgresql://") {
+		return driverPostgres
+	}
+	return driverSQLite
+}
+
+// openDB opens the database for reading; see tryOpenDB.
+func openDB(dsn string, o dbOptions) *DB {
+	db, err := tryOpenDB(dsn, o)
+	must(err)
+	return db
+}
+
+// openDBForWrite opens the database and migrates it, for commands that write
+// to it.
+func openDBForWrite(dsn string, o dbOptions) *DB {
+	db := openDB(dsn, o)
+	if err := db.migrate(context.Background()); err != nil {
+		db.Close()
+		must(err)
+	}
+	return db
+}
+
+// tryOpenDB opens and pings the database and notes which optional columns
+// and tables it lacks, returning any failure. It does not migrate, so
+// read-only databases open fine.
+func tryOpenDB(dsn string, o dbOptions) (*DB, error) {
+	if !validTablePrefix(o.TablePrefix) {
+		return nil, fmt.Errorf("invalid table prefix %q (want letters, digits and _)", o.TablePrefix)
+	}
+	driver := dbDriver(dsn)
+	if driver == driverSQLite {
+		dsn = withBusyTimeout(dsn)
+		if o.ReadOnly {
+			dsn = withPragma(dsn, "query_only(1)")
+		}
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := &DB{DB: db, driver: driver, prefix: o.TablePrefix, retries: max(o.Retries, 0)}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := d.loadSchema(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// rebind rewrites "?" placeholders as "$1", "$2", … for Postgres. Question
+// marks inside single-quoted literals are left alone.
+func rebind(driver, query string) string {
+	if driver != driverPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n, inQuote := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// withBusyTimeout adds the busy_timeout pragma to a SQLite DSN unless it
+// already sets one.
+func withBusyTimeout(dsn string) string {
+	if strings.Contains(dsn, "busy_timeout") {
+		return dsn
+	}
+	return withPragma(dsn, fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout.Milliseconds()))
+}
+
+// withPragma adds a _pragma parameter, e.g. "query_only(1)", to a SQLite DSN.
+func withPragma(dsn, pragma string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=" + pragma
+}
+
+// isBusy reports whether err is SQLite's SQLITE_BUSY or SQLITE_LOCKED.
+func isBusy(err error) bool {
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) {
+		switch coded.Code() & 0xff { // primary code of an extended one
+		case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+			return true
+		}
+	}
+	return false
+}
+
+// busyBackoff is the pause before retry attempt+1 on a busy database.
+func busyBackoff(attempt int) time.Duration {
+	return min(50*time.Millisecond<<attempt, 2*time.Second)
+}
+
+// retry runs op, running it again after a short pause while it fails with a
+// busy database, up to db.retries more times.
+func (db *DB) retry(ctx context.Context, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if attempt >= db.retries || !isBusy(err) {
+			return err
+		}
+		if err := sleepCtx(ctx, busyBackoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+var (
+	tableRef    = regexp.MustCompile(`\{([a-z_]+)\}`) // a {table} reference in a query
+	tablePrefix = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
+)
+
+// validTablePrefix reports whether prefix is safe to splice into SQL.
+func validTablePrefix(prefix string) bool { return tablePrefix.MatchString(prefix) }
+
+// query prepares a package query for this database: each {table} becomes
+// the prefixed table name and placeholders are rebound for the driver.
+func (db *DB) query(q string) string {
+	return rebind(db.driver, tableRef.ReplaceAllString(q, db.prefix+"$1"))
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (res sql.Result, err error) {
+	err = db.retry(ctx, func() error {
+		res, err = db.DB.ExecContext(ctx, db.query(query), args...)
+		return err
+	})
+	return res, err
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (rows *sql.Rows, err error) {
+	err = db.retry(ctx, func() error {
+		rows, err = db.DB.QueryContext(ctx, db.query(query), args...)
+		return err
+	})
+	return rows, err
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) (row *sql.Row) {
+	// A Row defers its error to Scan, but Err exposes it early enough to retry.
+	db.retry(ctx, func() error {
+		row = db.DB.QueryRowContext(ctx, db.query(query), args...)
+		return row.Err()
+	})
+	return row
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+// Tx is a transaction that rewrites queries like DB.
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.db.query(query), args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.db.query(query), args...)
+}
+
+// labelNumber is an SQL expression for the leading integer of texts.label,
+// so "58, 59" sorts as 58.
+func (db *DB) labelNumber() string {
+	if db.driver == driverPostgres {
+		return `CAST(substring(label from '^[0-9]+') AS INTEGER)`
+	}
+	return `CAST(label AS INTEGER)`
+}
+
+// optionalColumns are the texts columns added since the original create.sql;
+// optionalTables are the tables added since.
+var (
+	optionalColumns = []string{"pali", "chapter", "translator_id"}
+	optionalTables  = []string{"posted_hashes", "kv", "post_events", "translators", "tags"}
+)
+
+// loadSchema records which optional columns and tables are missing, so read
+// paths can do without them on a database that was never migrated.
+func (db *DB) loadSchema(ctx context.Context) error {
+	cols, err := db.textColumns(ctx)
+	if err != nil {
+		return err
+	}
+	db.missing = map[string]bool{}
+	for _, c := range optionalColumns {
+		if !cols[c] {
+			db.missing[c] = true
+		}
+	}
+	for _, t := range optionalTables {
+		rows, err := db.QueryContext(ctx, `SELECT * FROM {`+t+`} LIMIT 0`)
+		if err != nil {
+			db.missing[t] = true
+			continue
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+// migrate brings the schema up to date (see ensureSchema).
+func (db *DB) migrate(ctx context.Context) error {
+	if err := ensureSchema(ctx, db); err != nil {
+		return err
+	}
+	return db.loadSchema(ctx)
+}
+
+// has reports whether the database has the optional column or table name.
+func (db *DB) has(name string) bool { return !db.missing[name] }
+
+// textColumn selects the optional text column col, or an empty string when the
+// database lacks it.
+func (db *DB) textColumn(col string) string {
+	if !db.has(col) {
+		return `''`
+	}
+	return `COALESCE(` + col + `, '')`
+}
+
+// attributionColumn selects a verse's attribution from its translator
+// record, or translator 1 for verses without one; an empty string when the
+// database has no translators.
+func (db *DB) attributionColumn() string {
+	if !db.has("translators") {
+		return `''`
+	}
+	id := `COALESCE({texts}.translator_id, 1)`
+	if !db.has("translator_id") {
+		id = `1`
+	}
+	return `COALESCE((SELECT attribution FROM {translators} WHERE {translators}.id = ` + id + `), '')`
+}
+
+// verseColumns selects the pali, chapter and attribution of a verse, for
+// scanning into model.Text's Pali, Chapter and Attribution.
+func (db *DB) verseColumns() string {
+	return db.textColumn("pali") + ", " + db.textColumn("chapter") + ", " + db.attributionColumn()
+}
+
+// textColumns returns the (lower-cased) column names of texts.
+func (db *DB) textColumns(ctx context.Context) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT * FROM {texts} LIMIT 0`)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	for _, c := range cols {
+		have[strings.ToLower(c)] = true
+	}
+	return have, nil
+}
+
+// ensureSchema brings databases created from an older create.sql up to date
+// by adding any missing optional columns and tables.
+func ensureSchema(ctx context.Context, db *DB) error {
+	have, err := db.textColumns(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range []struct{ name, ddl string }{
+		{"pali", `ALTER TABLE {texts} ADD COLUMN pali TEXT NULL`},
+		{"chapter", `ALTER TABLE {texts} ADD COLUMN chapter TEXT NULL`},
+		{"translator_id", `ALTER TABLE {texts} ADD COLUMN translator_id INTEGER NULL`},
+	} {
+		if have[col.name] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, col.ddl); err != nil {
+			return fmt.Errorf("add texts.%s: %w", col.name, err)
+		}
+	}
+
+	for _, ddl := range []string{
+		`CREATE TABLE IF NOT EXISTS {posted_hashes} (
+  hash       TEXT PRIMARY KEY,
+  text_id    INTEGER NOT NULL,
+  posted_at  TEXT NOT NULL
+)`,
+		`CREATE TABLE IF NOT EXISTS {kv} (
+  key        TEXT PRIMARY KEY,
+  value      TEXT NOT NULL
+)`,
+		`CREATE TABLE IF NOT EXISTS {post_events} (
+  text_id    INTEGER NOT NULL,
+  status     TEXT NOT NULL,
+  body       TEXT NOT NULL,
+  post_id    TEXT NULL,
+  created_at TEXT NOT NULL
+)`,
+		`CREATE TABLE IF NOT EXISTS {translators} (
+  id          INTEGER PRIMARY KEY,
+  name        TEXT NOT NULL,
+  attribution TEXT NOT NULL
+)`,
+		`CREATE TABLE IF NOT EXISTS {tags} (
+  text_id    INTEGER NOT NULL,
+  tag        TEXT NOT NULL,
+  PRIMARY KEY (text_id, tag)
+)`,
+		// Verses without a translator_id use translator 1, Max Müller's
+		// translation, which the existing data is.
+		`INSERT INTO {translators} (id, name, attribution)
+VALUES (1, 'F Max Müller', 'Dhammapada (F Max Müller)')
+ON CONFLICT (id) DO NOTHING`,
+	} {
+		if _, err := db.ExecContext(ctx, ddl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDBDriver(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"./data/dhammapada.sqlite", driverSQLite},
+		{"/var/lib/dhammapada.db", driverSQLite},
+		{"file:test.db?cache=shared", driverSQLite},
+		{"postgres://user:pw@localhost/dhammapada?sslmode=disable", driverPostgres},
+		{"postgresql://localhost/dhammapada", driverPostgres},
+		{"POSTGRES://localhost/dhammapada", driverPostgres},
+	}
+	for _, tt := range tests {
+		if got := dbDriver(tt.dsn); got != tt.want {
+			t.Errorf("dbDriver(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		driver, query, want string
+	}{
+		{driverSQLite, "SELECT 1 FROM t WHERE a = ? AND b = ?", "SELECT 1 FROM t WHERE a = ? AND b = ?"},
+		{driverPostgres, "SELECT 1 FROM t WHERE a = ? AND b = ?", "SELECT 1 FROM t WHERE a = $1 AND b = $2"},
+		{driverPostgres, "SELECT 1 FROM t WHERE id NOT IN (?,?,?)", "SELECT 1 FROM t WHERE id NOT IN ($1,$2,$3)"},
+		{driverPostgres, "SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{driverPostgres, "SELECT 1", "SELECT 1"},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.driver, tt.query); got != tt.want {
+			t.Errorf("rebind(%s, %q) = %q, want %q", tt.driver, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTablePrefix(t *testing.T) {
+	ctx := context.Background()
+	sqldb, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{DB: sqldb, driver: driverSQLite, prefix: "bookb_"}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE bookb_texts (
+		id        INTEGER PRIMARY KEY,
+		label     TEXT NOT NULL UNIQUE,
+		text_body TEXT NOT NULL,
+		posted_at TEXT NULL,
+		x_post_id TEXT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureSchema(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO {texts} (label, text_body) VALUES ('1', 'Mind precedes all.')`); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := selectText(ctx, db, selector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.Label != "1" {
+		t.Errorf("selected label %q, want 1", text.Label)
+	}
+	for _, table := range []string{"bookb_texts", "bookb_posted_hashes", "bookb_kv", "bookb_post_events"} {
+		var n int
+		if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = ?`, table).Scan(&n); err != nil || n != 1 {
+			t.Errorf("table %s: count %d, err %v", table, n, err)
+		}
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = 'texts'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("unprefixed texts table created (count %d, err %v)", n, err)
+	}
+}
+
+func TestValidTablePrefix(t *testing.T) {
+	for _, p := range []string{"", "dhp_", "Book2_"} {
+		if !validTablePrefix(p) {
+			t.Errorf("validTablePrefix(%q) = false", p)
+		}
+	}
+	for _, p := range []string{"a b", "x;", `dhp"`, "a-b"} {
+		if validTablePrefix(p) {
+			t.Errorf("validTablePrefix(%q) = true", p)
+		}
+	}
+}
+
+func TestWithBusyTimeout(t *testing.T) {
+	tests := []struct{ dsn, want string }{
+		{"./data/dhammapada.sqlite", "./data/dhammapada.sqlite?_pragma=busy_timeout(5000)"},
+		{"file:test.db?cache=shared", "file:test.db?cache=shared&_pragma=busy_timeout(5000)"},
+		{"x.db?_pragma=busy_timeout(100)", "x.db?_pragma=busy_timeout(100)"},
+	}
+	for _, tt := range tests {
+		if got := withBusyTimeout(tt.dsn); got != tt.want {
+			t.Errorf("withBusyTimeout(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+// lockDB opens path separately and holds an exclusive lock on it until the
+// returned function is called.
+func lockDB(t *testing.T, path string) (unlock func()) {
+	t.Helper()
+	ctx := context.Background()
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+	conn, err := other.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(ctx, `BEGIN EXCLUSIVE`); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		conn.ExecContext(ctx, `COMMIT`)
+		conn.Close()
+	}
+}
+
+func TestDB_RetriesWhileLocked(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "locked.sqlite")
+	// No busy_timeout, so SQLite reports SQLITE_BUSY at once.
+	sqldb, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+	db := &DB{DB: sqldb, driver: driverSQLite, retries: 5}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE t (n INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock := lockDB(t, path)
+	time.AfterFunc(120*time.Millisecond, unlock)
+	if _, err := db.ExecContext(ctx, `INSERT INTO t (n) VALUES (1)`); err != nil {
+		t.Fatalf("insert while locked, with retries: %v", err)
+	}
+
+	unlock = lockDB(t, path)
+	time.AfterFunc(120*time.Millisecond, unlock)
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM t`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("count while locked, with retries: %d, %v", n, err)
+	}
+
+	db.retries = 0
+	unlock = lockDB(t, path)
+	defer unlock()
+	_, err = db.ExecContext(ctx, `INSERT INTO t (n) VALUES (2)`)
+	if !isBusy(err) {
+		t.Errorf("insert while locked, no retries: err = %v, want busy", err)
+	}
+}
+
+// readOnlyLegacyDB creates a SQLite file with only the original texts table
+// and opens it read-only.
+func readOnlyLegacyDB(t *testing.T) (*DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "legacy.sqlite")
+	sqldb, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		`CREATE TABLE texts (id INTEGER PRIMARY KEY, label TEXT NOT NULL UNIQUE, text_body TEXT NOT NULL, posted_at TEXT NULL, x_post_id TEXT NULL)`,
+		`INSERT INTO texts (id, label, text_body) VALUES (1, '1', 'Mind precedes all mental states.')`,
+	} {
+		if _, err := sqldb.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sqldb.Close()
+
+	db, err := tryOpenDB("file:"+path+"?mode=ro", dbOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+func TestOpenDB_ReadOnlyLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	db, _ := readOnlyLegacyDB(t)
+	for _, name := range append(optionalColumns, optionalTables...) {
+		if db.has(name) {
+			t.Errorf("legacy database reported as having %s", name)
+		}
+	}
+
+	text, err := selectText(ctx, db, selector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.Label != "1" || text.Pali != "" || text.Attribution != "" {
+		t.Errorf("selected %+v", text)
+	}
+	if _, err := selectText(ctx, db, selector{tag: "mind"}); !errors.Is(err, errNoUnposted) {
+		t.Errorf("tag filter without a tags table: got %v, want errNoUnposted", err)
+	}
+	if dup, err := bodyPosted(ctx, db, text.Body); err != nil || dup {
+		t.Errorf("bodyPosted = %v, %v", dup, err)
+	}
+	if v, err := getKV(ctx, db, kvLastPostID); err != nil || v != "" {
+		t.Errorf("getKV = %q, %v", v, err)
+	}
+	if _, err := allTexts(ctx, db); err != nil {
+		t.Errorf("allTexts: %v", err)
+	}
+	if problems, err := verifyDB(ctx, db); err != nil || len(problems) > 0 {
+		t.Errorf("verifyDB = %v, %v", problems, err)
+	}
+
+	// Writing paths migrate first, which a read-only database refuses.
+	if err := db.migrate(ctx); err == nil {
+		t.Error("migrating a read-only database succeeded")
+	}
+}
+
+func TestOpenDB_ReadOnlyOption(t *testing.T) {
+	_, path := readOnlyLegacyDB(t)
+	db, err := tryOpenDB(path, dbOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var out bytes.Buffer
+	if err := printStatus(context.Background(), &out, &runner{db: db, imagesDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "1: Mind precedes") {
+		t.Errorf("printed %q", out.String())
+	}
+	if _, err := db.Exec(`UPDATE texts SET posted_at = CURRENT_TIMESTAMP`); err == nil {
+		t.Error("a read-only open accepted a write")
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&n)
+	if n != 1 {
+		t.Errorf("%d tables after printing a status, want just texts", n)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Discord message limits: content length in characters and attachments per
+// message. There is no 280-rune cap, so statuses get the larger budget.
+const (
+	discordMaxLen   = 2000
+	discordMaxFiles = 10
+)
+
+// discordPoster posts to a Discord channel webhook: the status as the message
+// content and the images as file attachments, in a single request.
+type discordPoster struct {
+	client     *http.Client
+	webhookURL string
+	spoiler    bool // attach images as spoilers (-sensitive), blurred until clicked
+}
+
+func newDiscordPosterFromEnv() *discordPoster {
+	u := os.Getenv("DISCORD_WEBHOOK_URL")
+	if u == "" {
+		log.Fatalf("missing required env var: DISCORD_WEBHOOK_URL")
+	}
+	return &discordPoster{client: &http.Client{Transport: httpTransport}, webhookURL: u}
+}
+
+func (p *discordPoster) maxMedia() int { return discordMaxFiles }
+
+func (p *discordPoster) Post(ctx context.Context, status string, images []string) (string, error) {
+	if len(images) > discordMaxFiles {
+		images = images[:discordMaxFiles]
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	payload, err := json.Marshal(map[string]string{"content": status})
+	if err != nil {
+		return "", err
+	}
+	if err := w.WriteField("payload_json", string(payload)); err != nil {
+		return "", err
+	}
+	for i, img := range images {
+		name := filepath.Base(img)
+		if p.spoiler {
+			name = "SPOILER_" + name // Discord's marker for spoiler attachments
+		}
+		if err := addFilePart(w, fmt.Sprintf("files[%d]", i), img, name); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	// wait=true makes Discord return the created message, with its id. The
+	// webhook URL holds its secret token, so it is kept out of errors.
+	const redacted = "<DISCORD_WEBHOOK_URL>"
+	u, err := url.Parse(p.webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("DISCORD_WEBHOOK_URL: %w", redactURLError(err, redacted))
+	}
+	q := u.Query()
+	q.Set("wait", "true")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), &buf)
+	if err != nil {
+		return "", redactURLError(err, redacted)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", redactURLError(err, redacted)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(b),
+			msg:        fmt.Sprintf("discord webhook %d: %s", resp.StatusCode, b),
+		}
+	}
+
+	var msg struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return "", err
+	}
+	if msg.ID == "" {
+		return "", fmt.Errorf("discord webhook: missing message id in response")
+	}
+	return msg.ID, nil
+}
+
+// addFilePart copies the file at path into a multipart part named field,
+// with the given file name.
+func addFilePart(w *multipart.Writer, field, path, filename string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
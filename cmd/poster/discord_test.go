@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiscordPoster_Post(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"1.jpg", "1-2.jpg"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, fakeJPEG, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	var content string
+	var files []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("wait") != "true" {
+			t.Errorf("expected wait=true, got %q", r.URL.RawQuery)
+		}
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("expected a multipart body: %v", err)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("reading part: %v", err)
+				return
+			}
+			b, _ := io.ReadAll(part)
+			switch {
+			case part.FormName() == "payload_json":
+				var p struct{ Content string }
+				json.Unmarshal(b, &p)
+				content = p.Content
+			case strings.HasPrefix(part.FormName(), "files["):
+				if string(b) != string(fakeJPEG) {
+					t.Errorf("%s: unexpected file contents", part.FormName())
+				}
+				files = append(files, part.FormName()+"="+part.FileName())
+			}
+		}
+		w.Write([]byte(`{"id":"1234567890"}`))
+	}))
+	defer srv.Close()
+
+	p := &discordPoster{client: srv.Client(), webhookURL: srv.URL + "/api/webhooks/1/token"}
+	id, err := p.Post(context.Background(), "1: All that we are…", paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1234567890" {
+		t.Errorf("expected message id 1234567890, got %q", id)
+	}
+	if content != "1: All that we are…" {
+		t.Errorf("unexpected content %q", content)
+	}
+	if strings.Join(files, ",") != "files[0]=1.jpg,files[1]=1-2.jpg" {
+		t.Errorf("unexpected file parts %v", files)
+	}
+}
+
+func TestDiscordPoster_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Unknown Webhook","code":10015}`))
+	}))
+	defer srv.Close()
+
+	p := &discordPoster{client: srv.Client(), webhookURL: srv.URL}
+	_, err := p.Post(context.Background(), "verse", nil)
+	if err == nil || !strings.Contains(err.Error(), "Unknown Webhook") {
+		t.Errorf("expected the webhook error, got %v", err)
+	}
+}
+
+func TestDiscordPoster_TransportErrorHidesWebhookURL(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // connections are refused
+
+	p := &discordPoster{client: srv.Client(), webhookURL: srv.URL + "/api/webhooks/1/SECRET"}
+	_, err := p.Post(context.Background(), "1: verse", nil)
+	if err == nil {
+		t.Fatal("expected a transport error")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("error leaks the webhook URL: %v", err)
+	}
+}
+
+func TestDiscordPoster_SpoilerImages(t *testing.T) {
+	img := filepath.Join(t.TempDir(), "1.jpg")
+	if err := os.WriteFile(img, fakeJPEG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var filename string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, fh, err := r.FormFile("files[0]"); err == nil {
+			filename = fh.Filename
+		}
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer srv.Close()
+
+	p := &discordPoster{client: srv.Client(), webhookURL: srv.URL, spoiler: true}
+	if _, err := p.Post(context.Background(), "1: verse", []string{img}); err != nil {
+		t.Fatal(err)
+	}
+	if filename != "SPOILER_1.jpg" {
+		t.Errorf("attachment named %q, want SPOILER_1.jpg", filename)
+	}
+}
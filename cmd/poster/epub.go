@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+// allTexts returns every verse, posted or not, in verse-number order.
+func allTexts(ctx context.Context, db *DB) ([]*model.Text, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT id, label, text_body, `+db.textColumn("pali")+`, `+db.textColumn("chapter")+`
+FROM {texts}
+ORDER BY `+db.labelNumber()+`, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*model.Text
+	for rows.Next() {
+		t := &model.Text{}
+		if err := rows.Scan(&t.ID, &t.Label, &t.Body, &t.Pali, &t.Chapter); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// epubChapter is a run of consecutive verses sharing a chapter name.
+type epubChapter struct {
+	Title  string
+	Verses []*model.Text
+}
+
+// groupChapters splits verses into runs by chapter; verses without a chapter
+// are grouped under "Verses".
+func groupChapters(texts []*model.Text) []epubChapter {
+	var out []epubChapter
+	for _, t := range texts {
+		title := strings.TrimSpace(t.Chapter)
+		if title == "" {
+			title = "Verses"
+		}
+		if len(out) == 0 || out[len(out)-1].Title != title {
+			out = append(out, epubChapter{Title: title})
+		}
+		out[len(out)-1].Verses = append(out[len(out)-1].Verses, t)
+	}
+	return out
+}
+
+// writeEPUB writes a minimal EPUB 3 book: the stored mimetype entry first,
+// the container, the package document, a navigation document and one XHTML
+// document per chapter.
+func writeEPUB(w io.Writer, title, author string, texts []*model.Text) error {
+	z := zip.NewWriter(w)
+
+	// The mimetype must be the first entry, uncompressed.
+	mw, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mw, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	chapters := groupChapters(texts)
+	files := map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`,
+		"OEBPS/content.opf": epubPackage(title, author, len(chapters)),
+		"OEBPS/nav.xhtml":   epubNav(title, chapters),
+	}
+	names := []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml"}
+	for i, ch := range chapters {
+		name := fmt.Sprintf("OEBPS/chapter%d.xhtml", i+1)
+		files[name] = epubChapterDoc(ch)
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		fw, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, files[name]); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func epubPackage(title, author string, nChapters int) string {
+	var manifest, spine strings.Builder
+	for i := 1; i <= nChapters; i++ {
+		fmt.Fprintf(&manifest, "    <item id=\"ch%d\" href=\"chapter%d.xhtml\" media-type=\"application/xhtml+xml\"/>\n", i, i)
+		fmt.Fprintf(&spine, "    <itemref idref=\"ch%d\"/>\n", i)
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">urn:dhammapada:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:creator>%s</dc:creator>
+    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+%s  </manifest>
+  <spine>
+%s  </spine>
+</package>
+`, html.EscapeString(strings.ReplaceAll(strings.ToLower(title), " ", "-")),
+		html.EscapeString(title), html.EscapeString(author),
+		time.Now().UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+}
+
+func epubNav(title string, chapters []epubChapter) string {
+	var items strings.Builder
+	for i, ch := range chapters {
+		fmt.Fprintf(&items, "      <li><a href=\"chapter%d.xhtml\">%s</a></li>\n", i+1, html.EscapeString(ch.Title))
+	}
+	return xhtmlDoc(title, fmt.Sprintf(`  <nav epub:type="toc" id="toc">
+    <h1>%s</h1>
+    <ol>
+%s    </ol>
+  </nav>
+`, html.EscapeString(title), items.String()))
+}
+
+func epubChapterDoc(ch epubChapter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  <h1>%s</h1>\n", html.EscapeString(ch.Title))
+	for _, t := range ch.Verses {
+		fmt.Fprintf(&b, "  <p><b>%s</b> %s</p>\n", html.EscapeString(t.Label), html.EscapeString(strings.TrimSpace(t.Body)))
+	}
+	return xhtmlDoc(ch.Title, b.String())
+}
+
+func xhtmlDoc(title, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="en">
+<head><title>%s</title></head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(title), body)
+}
+
+// exportEPUB writes every verse in the database to an EPUB file at path.
+func exportEPUB(ctx context.Context, db *DB, path, title, author string) error {
+	texts, err := allTexts(ctx, db)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeEPUB(f, title, author, texts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteEPUB(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	db.Exec(`INSERT INTO texts (id, label, text_body, chapter) VALUES (1, '2', 'Second & last.', 'Twin Verses')`)
+	db.Exec(`INSERT INTO texts (id, label, text_body, chapter) VALUES (2, '1', 'All that we are…', 'Twin Verses')`)
+	db.Exec(`INSERT INTO texts (id, label, text_body, chapter) VALUES (3, '21', 'Earnestness…', 'On Earnestness')`)
+
+	texts, err := allTexts(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeEPUB(&buf, "The Dhammapada", "F. Max Müller", texts); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := zr.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store {
+		t.Fatalf("first entry must be a stored mimetype, got %s (method %d)", first.Name, first.Method)
+	}
+	if got := readZipFile(t, first); got != "application/epub+zip" {
+		t.Errorf("mimetype = %q", got)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml"} {
+		if files[name] == nil {
+			t.Errorf("missing %s", name)
+		}
+	}
+	ch1 := files["OEBPS/chapter1.xhtml"]
+	if ch1 == nil || files["OEBPS/chapter2.xhtml"] == nil {
+		t.Fatal("expected one content document per chapter")
+	}
+	doc := readZipFile(t, ch1)
+	if !strings.Contains(doc, "<h1>Twin Verses</h1>") || !strings.Contains(doc, "Second &amp; last.") {
+		t.Errorf("unexpected chapter document:\n%s", doc)
+	}
+	if strings.Index(doc, "All that we are") > strings.Index(doc, "Second") {
+		t.Error("verses should be in verse-number order")
+	}
+}
+
+func readZipFile(t *testing.T, f *zip.File) string {
+	t.Helper()
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
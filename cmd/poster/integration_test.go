@@ -0,0 +1,107 @@
+//go:build integration
+
+package main
+
+// End-to-end check of the data pipeline, run with `make integration`: the
+// fixture testdata/texts.csv (the first verses of data/texts.csv, in the
+// layout the extractor writes) is loaded into a fresh SQLite database built
+// from internal/db/create.sql, then the poster binary does a dry run.
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIntegration_DryRunFromCSV(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "dhammapada.sqlite")
+	importFixture(t, dbPath, "testdata/texts.csv")
+
+	bin := filepath.Join(dir, "poster")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	preview := filepath.Join(dir, "preview.json")
+	cmd := exec.Command(bin, "-db", dbPath, "-order", "seq", "-images-dir", filepath.Join(dir, "images"), "-dry-run-out", preview)
+	// Dry runs never contact X, but the client still wants credentials.
+	cmd.Env = append(os.Environ(),
+		"DRY_RUN=1",
+		"X_CONSUMER_KEY=k", "X_CONSUMER_SECRET=s", "X_ACCESS_TOKEN=t", "X_ACCESS_SECRET=a",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("poster: %v\n%s", err, out)
+	}
+
+	b, err := os.ReadFile(preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got dryRunPreview
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("preview %s: %v", b, err)
+	}
+	if !strings.HasPrefix(got.Status, "1: ") || !strings.Contains(got.Status, "All that we are is the result of what we have thought") {
+		t.Errorf("status for verse 1 = %q", got.Status)
+	}
+	if got.Length == 0 || got.Length > xMaxLen {
+		t.Errorf("status length %d, want 1..%d", got.Length, xMaxLen)
+	}
+
+	// A dry run must not mark anything posted.
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var posted int
+	if err := db.QueryRow(`SELECT count(*) FROM texts WHERE posted_at IS NOT NULL`).Scan(&posted); err != nil {
+		t.Fatal(err)
+	}
+	if posted != 0 {
+		t.Errorf("%d verses marked posted by a dry run", posted)
+	}
+}
+
+// importFixture creates the schema from create.sql and loads a texts CSV
+// (id,label,text_body with a header row), as create_database.sh and
+// import_data.sh do with the sqlite3 shell.
+func importFixture(t *testing.T, dbPath, csvPath string) {
+	t.Helper()
+	schema, err := os.ReadFile("../../internal/db/create.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("create.sql: %v", err)
+	}
+
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 2 || strings.Join(rows[0], ",") != "id,label,text_body" {
+		t.Fatalf("%s: want an id,label,text_body header and at least one verse", csvPath)
+	}
+	for _, r := range rows[1:] {
+		if _, err := db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (?, ?, ?)`, r[0], r[1], r[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
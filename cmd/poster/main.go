@@ -2,21 +2,33 @@ package main
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"image/gif"
 	"io"
 	"log"
+	"maps"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
-
-	_ "modernc.org/sqlite"
+	"unicode"
 
 	"github.com/dghubble/oauth1"
 	"github.com/mikequentel/dhammapada/internal/model"
@@ -25,336 +37,1966 @@ import (
 func main() {
 	log.SetFlags(0)
 
-	// --- Config (env) ---
-	dbPath := envOr("DHAMMAPADA_DB", "./data/dhammapada.sqlite")
-	dryRun := os.Getenv("DRY_RUN") == "1"
+	// --- Config (flags); an optional leading word selects the command ---
+	cmd, cfg, err := parseArgs(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	run, ok := commands[cmd]
+	if !ok {
+		log.Fatalf("unknown command %q (want %s)", cmd, commandList())
+	}
+	run(cmd, cfg)
+}
+
+// commands maps each command word to its implementation.
+var commands = map[string]func(cmd string, cfg *config){
+	"post":          func(_ string, cfg *config) { runPost(cfg) },
+	"images-report": runImagesReport,
+	"add-tag":       runTagCommand,
+	"remove-tag":    runTagCommand,
+	"peek":          runPeek,
+	"epub":          runEPUB,
+	"anki":          runAnki,
+	"markdown":      runMarkdown,
+	"verify-db":     runVerifyDB,
+	"serve":         runServe,
+	"selftest":      runSelftest,
+}
 
-	ck := os.Getenv("X_CONSUMER_KEY")
-	cs := os.Getenv("X_CONSUMER_SECRET")
-	at := os.Getenv("X_ACCESS_TOKEN")
-	as := os.Getenv("X_ACCESS_SECRET")
+// commandList names the commands for usage errors, e.g. "anki, epub or peek".
+func commandList() string {
+	names := slices.Sorted(maps.Keys(commands))
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
 
-	for k, v := range map[string]string{
-		"X_CONSUMER_KEY":    ck,
-		"X_CONSUMER_SECRET": cs,
-		"X_ACCESS_TOKEN":    at,
-		"X_ACCESS_SECRET":   as,
-	} {
-		if v == "" {
-			log.Fatalf("missing required env var: %s", k)
-		}
+func runImagesReport(_ string, cfg *config) {
+	db := openDB(cfg.dbPath, cfg.db)
+	defer db.Close()
+	rep, err := buildImagesReport(context.Background(), db, cfg.imagesDir)
+	must(err)
+	must(printImagesReport(os.Stdout, rep, cfg.json))
+}
+
+// runTagCommand runs add-tag or remove-tag.
+func runTagCommand(cmd string, cfg *config) {
+	if cfg.sel.label == "" || cfg.sel.tag == "" {
+		log.Fatalf("%s needs -label and -tag", cmd)
+	}
+	db := openDBForWrite(cfg.dbPath, cfg.db)
+	defer db.Close()
+	if cmd == "add-tag" {
+		must(addTag(context.Background(), db, cfg.sel.label, cfg.sel.tag))
+	} else {
+		must(removeTag(context.Background(), db, cfg.sel.label, cfg.sel.tag))
 	}
+}
 
-	// --- DB init ---
-	db, err := sql.Open("sqlite", dbPath)
+func runPeek(_ string, cfg *config) {
+	db := openDB(cfg.dbPath, cfg.db)
+	defer db.Close()
+	texts, err := peek(context.Background(), db, cfg.sel, cfg.count)
 	must(err)
+	printPeek(os.Stdout, texts)
+}
+
+func runEPUB(_ string, cfg *config) {
+	db := openDB(cfg.dbPath, cfg.db)
+	defer db.Close()
+	out := cmp.Or(cfg.out, "dhammapada.epub")
+	must(exportEPUB(context.Background(), db, out, cfg.title, cfg.author))
+	log.Printf("Wrote %s", out)
+}
+
+func runAnki(_ string, cfg *config) {
+	db := openDB(cfg.dbPath, cfg.db)
+	defer db.Close()
+	out := cmp.Or(cfg.out, "dhammapada."+cfg.format)
+	must(exportAnki(context.Background(), db, out, cfg.format))
+	log.Printf("Wrote %s", out)
+}
+
+func runMarkdown(_ string, cfg *config) {
+	db := openDB(cfg.dbPath, cfg.db)
 	defer db.Close()
-	must(db.Ping())
+	out := cmp.Or(cfg.out, "dhammapada.md")
+	must(exportMarkdown(context.Background(), db, out, cfg.verseMin, cfg.verseMax))
+	log.Printf("Wrote %s", out)
+}
 
-	// --- picks a random unposted text; derive images from label ---
-	t, err := getRandomUnpostedTextAndImages(context.Background(), db)
+func runVerifyDB(_ string, cfg *config) {
+	db := openDB(cfg.dbPath, cfg.db)
+	defer db.Close()
+	problems, err := verifyDB(context.Background(), db)
 	must(err)
+	printDBProblems(os.Stdout, problems)
+	if len(problems) > 0 {
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func runServe(_ string, cfg *config) {
+	if err := setupPlatform(cfg); err != nil {
+		log.Fatal(err)
+	}
+	db := openDB(cfg.dbPath, cfg.db)
+	defer db.Close()
+	r := previewRunner(cfg, db)
+	log.Printf("Serving previews on %s", cfg.addr)
+	must(http.ListenAndServe(cfg.addr, newServer(r)))
+}
+
+func runSelftest(_ string, cfg *config) {
+	var verify func() (string, error)
+	if cfg.platform == platformX && !cfg.skipVerify {
+		verify = func() (string, error) { return verifyXFromEnv(cfg) }
+	}
+	open := func() (*DB, error) { return tryOpenDB(cfg.dbPath, cfg.db) }
+	if !printChecklist(os.Stdout, selftest(context.Background(), open, verify, cfg.imagesDir)) {
+		os.Exit(1)
+	}
+}
+
+// parseArgs splits the command word, when given, from the flags that follow
+// it. Anything left after the flags is an error: a command word placed there
+// would otherwise be ignored and the run would fall through to post.
+func parseArgs(args []string) (string, *config, error) {
+	cmd := "post"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	cfg := &config{}
+	fs := newFlagSet(cfg)
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return "", nil, fmt.Errorf("unexpected argument %q: the command goes before the flags, e.g. poster %s -db ...", fs.Arg(0), fs.Arg(0))
+	}
+	return cmd, cfg, nil
+}
+
+// config holds the command-line options shared by all commands.
+type config struct {
+	dbPath        string
+	imagesDir     string
+	dryRunOut     string
+	skipVerify    bool
+	requireImages bool
+	count         int
+	interval      time.Duration
+	pollOpts      string
+	pollMinutes   int
+	sel           selector
+	json          bool
+	status        statusOptions
+	noRepeat      bool
+	upload        uploadOptions
+	platform      string
+	chain         bool
+	scheduleAt    time.Time
+	out           string
+	title         string
+	author        string
+	format        string
+	verseMin      int
+	verseMax      int
+	recordDryRun  bool
+	printStatus   bool
+	db            dbOptions
+	tokenStore    string
+	credsFile     string
+	edit          bool
+	manifest      string
+	addr          string
+	yes           bool
+}
+
+func newFlagSet(cfg *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("poster", flag.ExitOnError)
+	cfg.platform = platformX
+	fs.Func("platform", "where to post: x (default), discord or telegram", func(v string) error {
+		switch v {
+		case platformX, platformDiscord, platformTelegram:
+			cfg.platform = v
+			return nil
+		}
+		return fmt.Errorf("unknown platform %q", v)
+	})
+	fs.StringVar(&cfg.dbPath, "db", envOr("DHAMMAPADA_DB", "./data/dhammapada.sqlite"), "SQLite database path, or a postgres:// URL")
+	fs.Func("table-prefix", "prefix for all table names, e.g. dhp_ for dhp_texts (lets several bots share a database)", func(v string) error {
+		if !validTablePrefix(v) {
+			return fmt.Errorf("want letters, digits and _, got %q", v)
+		}
+		cfg.db.TablePrefix = v
+		return nil
+	})
+	fs.IntVar(&cfg.db.Retries, "db-retries", 3, "times to retry a statement when SQLite reports the database busy/locked (after its own 5s busy_timeout)")
+	fs.StringVar(&cfg.dryRunOut, "dry-run-out", "", "dry run: write the preview as JSON to this file instead of stdout")
+	fs.StringVar(&cfg.imagesDir, "images-dir", envOr("DHAMMAPADA_IMAGES_DIR", "images"), "directory holding verse images")
+	fs.BoolVar(&cfg.printStatus, "print-status", false, "print only the rendered status of the next verse and exit: no logs, no network, nothing marked posted")
+	fs.StringVar(&cfg.addr, "addr", "localhost:8080", "serve: address to listen on")
+	fs.StringVar(&cfg.manifest, "manifest", "", "append a JSON line per successful post (verse_label, tweet_id, posted_at, platform, media_count) to this file")
+	fs.BoolVar(&cfg.edit, "edit", false, "with -label: delete the verse's existing post and post its current text instead (needs -yes)")
+	fs.BoolVar(&cfg.yes, "yes", false, "confirm -edit")
+	fs.Func("exclude-labels", `comma-separated labels never to select, e.g. "12,58-59" (write ranges with a dash)`, func(v string) error {
+		for _, l := range strings.Split(v, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				cfg.sel.excludeLabels = append(cfg.sel.excludeLabels, l)
+			}
+		}
+		return nil
+	})
+	fs.StringVar(&cfg.sel.tag, "tag", "", "select only verses with this tag (add-tag, remove-tag: the tag)")
+	fs.StringVar(&cfg.sel.label, "label", "", "select the unposted verse with this label instead of choosing one")
+	fs.BoolVar(&cfg.recordDryRun, "record-dry-run", false, "dry run: record a dry_run row in post_events (posted_at is still not set)")
+	fs.StringVar(&cfg.credsFile, "credentials-file", "", "JSON file of X_* credentials, used for any unset in the environment; must not be readable by others")
+	fs.StringVar(&cfg.tokenStore, "token-store", "", "with X_REFRESH_TOKEN: file to load OAuth2 tokens from and save refreshed ones to")
+	fs.BoolVar(&cfg.skipVerify, "skip-verify", false, "skip the X credentials preflight check")
+	fs.BoolVar(&cfg.requireImages, "require-images", false, "abort if any image is missing or unreadable instead of dropping it")
+	fs.IntVar(&cfg.count, "count", 1, "number of verses to post in this run (peek: to preview)")
+	fs.DurationVar(&cfg.interval, "interval", time.Minute, "delay between posts when -count > 1")
+	fs.StringVar(&cfg.pollOpts, "poll", "", "attach a poll with these comma-separated options (2–4); the verse must have no images")
+	fs.IntVar(&cfg.pollMinutes, "poll-minutes", 1440, "how long the -poll stays open, in minutes")
+	fs.Func("seed", "pick verses with a seeded Go PRNG instead of SQLite RANDOM(), for reproducible runs", func(v string) error {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		cfg.sel.rng = rand.New(rand.NewSource(seed))
+		return nil
+	})
+	fs.BoolVar(&cfg.json, "json", false, "images-report: print JSON instead of text")
+	fs.StringVar(&cfg.out, "out", "", "epub, anki, markdown: output file (default dhammapada.<format>)")
+	fs.StringVar(&cfg.format, "format", ankiTSV, "anki: export format, tsv (apkg is not supported yet)")
+	fs.IntVar(&cfg.verseMin, "verse-min", 0, "markdown: export only verses numbered at least this (0: from the first)")
+	fs.IntVar(&cfg.verseMax, "verse-max", 0, "markdown: export only verses numbered at most this (0: to the last)")
+	fs.StringVar(&cfg.title, "title", "The Dhammapada", "epub: book title")
+	fs.StringVar(&cfg.author, "author", "F. Max Müller (translator)", "epub: book author")
+	fs.Func("order", "verse selection order: random (default), seq (ascending verse number) or seq-desc (descending)", func(v string) error {
+		switch v {
+		case orderRandom, orderSeq, orderSeqDesc:
+			cfg.sel.order = v
+			return nil
+		}
+		return fmt.Errorf("unknown order %q", v)
+	})
+	fs.BoolVar(&cfg.status.Bilingual, "bilingual", false, "append the Pāli (when stored) after the English verse")
+	fs.BoolVar(&cfg.status.ChapterHashtag, "append-hashtag-from-chapter", false, "add a hashtag built from the verse's chapter name (when stored)")
+	fs.StringVar(&cfg.status.Ellipsis, "ellipsis", "…", `marks where a long verse was cut, e.g. "..." for plain ASCII`)
+	fs.BoolVar(&cfg.status.TextInAlt, "text-in-alt", false, "for verses with images (e.g. calligraphy of the verse), post only the label and attribution and put the verse in the first image's alt text (X only)")
+	fs.BoolVar(&cfg.status.StripVerseNum, "strip-verse-numbers-in-body", false, "drop a trailing number from a verse body when it is the next verse's number (an OCR leak)")
+	fs.Func("max-len", "status length budget in runes (default 280 on X, up to 25000 for premium accounts; the platform's limit elsewhere)", func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("want a positive number of runes, got %q", v)
+		}
+		cfg.status.MaxLen = n
+		return nil
+	})
+	fs.BoolVar(&cfg.status.NoHashtags, "no-hashtags", false, "leave the hashtags out of the status, leaving more room for the verse")
+	fs.BoolVar(&cfg.status.NoAttribution, "no-attribution", false, "leave the attribution out of the status, leaving more room for the verse")
+	fs.BoolVar(&cfg.status.Pretty, "pretty", false, "put the label, body, attribution and hashtags on separate lines")
+	fs.StringVar(&cfg.status.AttributionSep, "attribution-sep", "—", `separator before the attribution, e.g. "-" for plain ASCII`)
+	fs.StringVar(&cfg.status.LabelPrefix, "label-prefix", "", `word before the verse label, e.g. "Dhp" gives "Dhp 183: …"`)
+	fs.IntVar(&cfg.status.MaxBodyChars, "max-body-chars", 0, "cut the verse body to this many characters, at a word boundary, before fitting the post (0: no cap)")
+	fs.DurationVar(&cfg.sel.cooldown, "cooldown", 0, "treat verses posted longer ago than this as unposted (e.g. 168h); 0 disables")
+	fs.BoolVar(&cfg.noRepeat, "no-repeat", false, "skip verses whose body was already posted (per posted_hashes)")
+	fs.Func("schedule-at", "schedule the post for this RFC3339 time instead of posting now (X; needs X_ADS_ACCOUNT_ID)", func(v string) error {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return err
+		}
+		cfg.scheduleAt = t
+		return nil
+	})
+	fs.BoolVar(&cfg.chain, "chain", false, "post each verse as a reply to the previous one, forming one thread")
+	fs.Func("upload-mode", "image upload path: auto (default; chunked above 5MB), simple or chunked", func(v string) error {
+		switch v {
+		case uploadAuto, uploadSimple, uploadChunked:
+			cfg.upload.Mode = v
+			return nil
+		}
+		return fmt.Errorf("unknown upload mode %q", v)
+	})
+	fs.IntVar(&cfg.upload.Concurrency, "upload-concurrency", 1, "upload up to this many of a post's images at once")
+	fs.BoolVar(&cfg.upload.Sensitive, "sensitive", false, "mark the post's images as sensitive media (X), or as spoilers (Discord, Telegram)")
+	fs.BoolVar(&cfg.upload.BestEffort, "best-effort-media", false, "post with the images that uploaded if others fail")
+	fs.StringVar(&userAgent, "user-agent", defaultUserAgent, "User-Agent header for all outbound HTTP requests")
+	fs.StringVar(&verseURLTemplate, "verse-url-template", defaultVerseURLTemplate, "link to a posted verse; {id} is replaced by the post id")
+	return fs
+}
+
+// runPost selects, posts and marks verses (or previews one when dry-running).
+func runPost(cfg *config) {
+	if cfg.printStatus {
+		if err := setupPlatform(cfg); err != nil {
+			log.Fatal(err)
+		}
+		// No DB writes: no migration, and SQLite refuses any write.
+		o := cfg.db
+		o.ReadOnly = true
+		db := openDB(cfg.dbPath, o)
+		defer db.Close()
+		must(printStatus(context.Background(), os.Stdout, previewRunner(cfg, db)))
+		return
+	}
+
+	// --- Config (env) ---
+	dryRun := os.Getenv("DRY_RUN") == "1" || cfg.dryRunOut != ""
+	if cfg.edit {
+		switch {
+		case cfg.sel.label == "":
+			log.Fatal("-edit needs -label for the verse to re-post")
+		case !cfg.yes:
+			log.Fatalf("-edit deletes the existing post of verse %s; add -yes to confirm", cfg.sel.label)
+		case dryRun:
+			log.Fatal("-edit cannot be combined with a dry run")
+		case !cfg.scheduleAt.IsZero():
+			log.Fatal("-edit cannot be combined with -schedule-at")
+		}
+	}
+
+	if err := setupPlatform(cfg); err != nil {
+		log.Fatal(err)
+	}
+	var poster Poster
+	switch cfg.platform {
+	case platformDiscord:
+		dp := newDiscordPosterFromEnv()
+		dp.spoiler = cfg.upload.Sensitive
+		poster = dp
+	case platformTelegram:
+		tp := newTelegramPosterFromEnv()
+		tp.spoiler = cfg.upload.Sensitive
+		poster = tp
+	default:
+		poster = newXPosterFromEnv(cfg, dryRun)
+	}
+	if _, ok := poster.(threadPoster); cfg.chain && !ok {
+		log.Fatalf("-chain is not supported with -platform %s", cfg.platform)
+	}
+	if _, ok := poster.(deleterPoster); cfg.edit && !ok {
+		log.Fatalf("-edit is not supported with -platform %s", cfg.platform)
+	}
+	if _, ok := poster.(altTextPoster); cfg.status.TextInAlt && !ok {
+		log.Fatalf("-text-in-alt is not supported with -platform %s", cfg.platform)
+	}
+
+	// --- DB init ---
+	// A plain dry run only reads, so it works on a read-only database.
+	db := openDB(cfg.dbPath, cfg.db)
+	defer db.Close()
+	if !dryRun || cfg.recordDryRun {
+		must(db.migrate(context.Background()))
+	}
 
-	status := formatStatus(t.Label, t.Body)
+	r := &runner{
+		db:            db,
+		poster:        poster,
+		imagesDir:     cfg.imagesDir,
+		sel:           cfg.sel,
+		requireImages: cfg.requireImages,
+		count:         cfg.count,
+		interval:      cfg.interval,
+		status:        cfg.status,
+		noRepeat:      cfg.noRepeat,
+		chain:         cfg.chain,
+		manifest:      cfg.manifest,
+		platform:      cfg.platform,
+		scheduled:     !cfg.scheduleAt.IsZero(),
+		upload:        cfg.upload,
+	}
 
 	// --- dry-run preview ---
 	if dryRun {
-		fmt.Println("DRY RUN ✅ (no network calls)")
-		fmt.Printf("Status:\n---\n%s\n---\n", status)
-		if len(t.Images) == 0 {
-			fmt.Println("Images: (none)")
+		preview, err := r.dryRun(context.Background(), cfg.recordDryRun)
+		must(err)
+		if cfg.dryRunOut != "" {
+			must(writeDryRunPreview(cfg.dryRunOut, preview))
+			log.Printf("DRY RUN ✅ preview written to %s", cfg.dryRunOut)
 		} else {
-			fmt.Println("Images:")
-			for _, p := range t.Images {
-				fmt.Println(" -", p)
+			printDryRunPreview(os.Stdout, preview)
+		}
+		return
+	}
+
+	if cfg.edit {
+		id, err := r.edit(context.Background(), cfg.sel.label)
+		must(err)
+		log.Printf("Re-posted verse %s as %s", cfg.sel.label, verseURL(id))
+		return
+	}
+
+	// --- selects, posts and marks verses, one commit per post ---
+	// SIGINT/SIGTERM stop the batch between posts; see runner.postOne.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	posted, err := r.postBatch(ctx)
+	if posted > 1 || cfg.count > 1 {
+		log.Printf("Posted %d of %d verse(s)", posted, cfg.count)
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Fatalf("Interrupted; stopped after %d post(s)", posted)
+	}
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		log.Fatalf("X rejected the credentials; check the X_* env vars: %v", err)
+	}
+	must(err)
+}
+
+// setupPlatform checks the flags against cfg.platform and fills in the
+// platform's length budget when -max-len is unset.
+func setupPlatform(cfg *config) error {
+	if err := checkMaxLen(cfg.platform, cfg.status.MaxLen); err != nil {
+		return err
+	}
+	if err := checkXOnlyFlags(cfg); err != nil {
+		return err
+	}
+	if cfg.status.MaxLen == 0 {
+		switch cfg.platform {
+		case platformDiscord:
+			cfg.status.MaxLen = discordMaxLen
+		case platformTelegram:
+			cfg.status.MaxLen = telegramMaxLen
+		}
+	}
+	return nil
+}
+
+// previewRunner builds a runner for previews, which are never posted: its
+// poster is left unconfigured and only supplies cfg.platform's image limit.
+func previewRunner(cfg *config, db *DB) *runner {
+	var poster Poster
+	switch cfg.platform {
+	case platformDiscord:
+		poster = &discordPoster{}
+	case platformTelegram:
+		poster = &telegramPoster{}
+	default:
+		poster = &xPoster{upload: cfg.upload}
+	}
+	return &runner{
+		db:            db,
+		poster:        poster,
+		imagesDir:     cfg.imagesDir,
+		sel:           cfg.sel,
+		requireImages: cfg.requireImages,
+		status:        cfg.status,
+		noRepeat:      cfg.noRepeat,
+		platform:      cfg.platform,
+		upload:        cfg.upload,
+	}
+}
+
+// newXPosterFromEnv builds the X poster from the X_* env vars, checking the
+// credentials first unless dry-running or -skip-verify is set.
+func newXPosterFromEnv(cfg *config, dryRun bool) *xPoster {
+	// --- OAuth1 (or OAuth2, with X_REFRESH_TOKEN) user-context HTTP client ---
+	httpClient, err := newXHTTPClientFromEnv(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	poll, err := parsePoll(cfg.pollOpts, cfg.pollMinutes)
+	if err != nil {
+		log.Fatalf("invalid -poll: %v", err)
+	}
+
+	// --- preflight: confirm credentials before touching the DB ---
+	if !dryRun && !cfg.skipVerify {
+		handle, err := verifyCredentials(httpClient)
+		if err != nil {
+			log.Fatalf("credentials check failed: %v", err)
+		}
+		log.Printf("Authenticated as @%s", handle)
+	}
+
+	p := &xPoster{client: httpClient, poll: poll, upload: cfg.upload}
+	if !cfg.scheduleAt.IsZero() {
+		p.schedule = &xSchedule{At: cfg.scheduleAt, AccountID: os.Getenv("X_ADS_ACCOUNT_ID")}
+		if p.schedule.AccountID == "" {
+			log.Fatalf("missing required env var: X_ADS_ACCOUNT_ID (for -schedule-at)")
+		}
+		if err := p.schedule.check(time.Now()); err != nil {
+			log.Fatalf("invalid -schedule-at: %v", err)
+		}
+		if !dryRun {
+			me, err := fetchMe(httpClient)
+			if err != nil {
+				log.Fatalf("looking up the X user id for -schedule-at: %v", err)
+			}
+			p.schedule.UserID = me.ID
+		}
+	}
+	return p
+}
+
+// verifyXFromEnv checks the X_* credentials, returning the account handle.
+func verifyXFromEnv(cfg *config) (string, error) {
+	client, err := newXHTTPClientFromEnv(cfg)
+	if err != nil {
+		return "", err
+	}
+	handle, err := verifyCredentials(client)
+	if err != nil {
+		return "", err
+	}
+	return "@" + handle, nil
+}
+
+// ===================== DB + image derivation =====================
+
+var errNoUnposted = errors.New("no unposted texts remain")
+
+// errNoUnpostedExcluded is errNoUnposted when -exclude-labels may be why.
+var errNoUnpostedExcluded = fmt.Errorf("%w after exclusions", errNoUnposted)
+
+func getRandomUnpostedTextAndImages(ctx context.Context, db *DB, imagesDir string) (*model.Text, error) {
+	return selectTextAndImages(ctx, db, imagesDir, selector{})
+}
+
+// selector controls how the next unposted verse is chosen. The zero value
+// uses SQLite's RANDOM().
+type selector struct {
+	// order is orderRandom (the default when empty), orderSeq or orderSeqDesc.
+	order string
+	// rng, when set, picks from the sorted unposted ids in Go instead, so a
+	// given -seed always makes the same random choices.
+	rng *rand.Rand
+	// skipIDs are passed over for the rest of the run (e.g. repeats).
+	skipIDs []int64
+	// cooldown, when set, makes verses posted longer ago than this eligible
+	// again; anything posted more recently stays excluded.
+	cooldown time.Duration
+	// label, when set, restricts selection to the verse with that label.
+	label string
+	// tag, when set, restricts selection to verses with that tag.
+	tag string
+	// excludeLabels are never selected; compared after normalizeLabel.
+	excludeLabels []string
+}
+
+// noneLeft is the error for an empty selection.
+func (sel selector) noneLeft() error {
+	if len(sel.excludeLabels) > 0 {
+		return errNoUnpostedExcluded
+	}
+	return errNoUnposted
+}
+
+// sqlNormalizedLabel is normalizeLabel(label) in SQL.
+const sqlNormalizedLabel = `REPLACE(REPLACE(REPLACE(REPLACE(TRIM(label), ', ', '-'), ',', '-'), '–', '-'), ' ', '')`
+
+const (
+	orderRandom  = "random"
+	orderSeq     = "seq"      // lowest verse number first
+	orderSeqDesc = "seq-desc" // highest verse number first
+)
+
+// where returns the SQL condition, and its arguments, that candidate rows of
+// texts must satisfy.
+func (sel selector) where(db *DB) (string, []any) {
+	conds := []string{"posted_at IS NULL"}
+	var args []any
+	if sel.cooldown > 0 {
+		// posted_at holds CURRENT_TIMESTAMP, i.e. UTC "YYYY-MM-DD HH:MM:SS",
+		// which compares correctly as text.
+		conds[0] = "(posted_at IS NULL OR posted_at < ?)"
+		args = append(args, time.Now().Add(-sel.cooldown).UTC().Format(time.DateTime))
+	}
+	if sel.label != "" {
+		conds = append(conds, "label = ?")
+		args = append(args, sel.label)
+	}
+	switch {
+	case sel.tag != "" && !db.has("tags"):
+		conds = append(conds, "1 = 0") // nothing is tagged yet
+	case sel.tag != "":
+		conds = append(conds, "id IN (SELECT text_id FROM {tags} WHERE tag = ?)")
+		args = append(args, normalizeTag(sel.tag))
+	}
+	if len(sel.excludeLabels) > 0 {
+		conds = append(conds, sqlNormalizedLabel+" NOT IN ("+placeholders(len(sel.excludeLabels))+")")
+		for _, l := range sel.excludeLabels {
+			args = append(args, normalizeLabel(l))
+		}
+	}
+	if len(sel.skipIDs) > 0 {
+		conds = append(conds, "id NOT IN ("+placeholders(len(sel.skipIDs))+")")
+		for _, id := range sel.skipIDs {
+			args = append(args, id)
+		}
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// placeholders returns n comma-separated "?" parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func selectTextAndImages(ctx context.Context, db *DB, imagesDir string, sel selector) (*model.Text, error) {
+	t, err := selectText(ctx, db, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := deriveImagePaths(imagesDir, t.Label)
+	if err != nil {
+		return nil, err
+	}
+	t.Images = paths
+	return t, nil
+}
+
+func selectText(ctx context.Context, db *DB, sel selector) (*model.Text, error) {
+	orderBy := "RANDOM()"
+	switch {
+	case sel.order == orderSeq:
+		orderBy = db.labelNumber() + ", id"
+	case sel.order == orderSeqDesc:
+		orderBy = db.labelNumber() + " DESC NULLS LAST, id DESC"
+	case sel.rng != nil:
+		return selectSeededText(ctx, db, sel)
+	}
+
+	where, args := sel.where(db)
+	pick := `
+SELECT id, label, text_body, ` + db.verseColumns() + `
+FROM {texts}
+WHERE ` + where + `
+ORDER BY ` + orderBy + `
+LIMIT 1;
+`
+	t := &model.Text{}
+	if err := db.QueryRowContext(ctx, pick, args...).Scan(&t.ID, &t.Label, &t.Body, &t.Pali, &t.Chapter, &t.Attribution); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sel.noneLeft()
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+func selectSeededText(ctx context.Context, db *DB, sel selector) (*model.Text, error) {
+	where, args := sel.where(db)
+	rows, err := db.QueryContext(ctx, `SELECT id FROM {texts} WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, sel.noneLeft()
+	}
+
+	t := &model.Text{ID: ids[sel.rng.Intn(len(ids))]}
+	err = db.QueryRowContext(ctx, `SELECT label, text_body, `+db.verseColumns()+` FROM {texts} WHERE id = ?`, t.ID).
+		Scan(&t.Label, &t.Body, &t.Pali, &t.Chapter, &t.Attribution)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// imageExts are the recognised image extensions (matched case-insensitively),
+// in preference order.
+var imageExts = []string{".jpg", ".jpeg", ".png", ".webp", ".gif"}
+
+// deriveImagePaths returns the existing image paths in dir based on the
+// label. It returns every variant; each Poster caps how many it posts (see
+// mediaLimiter).
+//
+// Conventions supported (in order):
+//
+//	<dir>/<norm>.jpg|.jpeg|.png|.webp|.gif
+//	<dir>/<norm>-1.jpg|.jpeg|.png|.webp|.gif
+//	<dir>/<norm>-2.jpg|.jpeg|.png|.webp|.gif
+//	...
+//	<dir>/<norm>-<n>.jpg|.jpeg|.png|.webp|.gif
+//
+// where <norm> is the label normalized:
+//   - ", " and "," -> "-" (e.g., "58, 59" -> "58-59")
+//   - "–" (en dash) -> "-"
+//   - spaces removed
+//
+// Variants are ordered numerically by suffix (so -10 follows -2), with the
+// unsuffixed image first. When a variant exists with several extensions only
+// one is used, preferring them in imageExts order (so 42.jpg wins over
+// 42.png).
+func deriveImagePaths(dir, label string) ([]string, error) {
+	norm := normalizeLabel(label)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	type candidate struct {
+		path    string
+		variant int // 0 for <norm>.<ext>, n for <norm>-<n>.<ext>
+		ext     int // index into imageExts
+	}
+	var candidates []candidate
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		ext := slices.Index(imageExts, strings.ToLower(filepath.Ext(name)))
+		if ext < 0 {
+			continue
+		}
+		// Normalize the file name too, so "58–59.jpg" (en dash) matches as
+		// well as "58-59.jpg" whichever dash the label was stored with.
+		variant, ok := imageVariant(norm, normalizeLabel(strings.TrimSuffix(name, filepath.Ext(name))))
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, candidate{filepath.Join(dir, name), variant, ext})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].variant != candidates[j].variant {
+			return candidates[i].variant < candidates[j].variant
+		}
+		if candidates[i].ext != candidates[j].ext {
+			return candidates[i].ext < candidates[j].ext
+		}
+		return candidates[i].path < candidates[j].path
+	})
+
+	var out []string
+	for i, c := range candidates {
+		if i > 0 && candidates[i-1].variant == c.variant {
+			continue // already have the preferred extension for this variant
+		}
+		out = append(out, c.path)
+	}
+	// ok if zero images; tweet will be text-only
+	return out, nil
+}
+
+// imageVariant reports whether stem names an image for norm, returning 0 for
+// the base image and n for a "<norm>-<n>" variant.
+func imageVariant(norm, stem string) (int, bool) {
+	if stem == norm {
+		return 0, true
+	}
+	suffix, ok := strings.CutPrefix(stem, norm+"-")
+	if !ok || suffix == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n <= 0 || strconv.Itoa(n) != suffix {
+		return 0, false
+	}
+	return n, true
+}
+
+// usableImages drops images that are missing or unreadable, logging each, so
+// the post can go ahead with whatever remains (possibly text-only). With
+// strict set, the first bad image is an error instead.
+func usableImages(paths []string, strict bool) ([]string, error) {
+	var out []string
+	for _, p := range paths {
+		// sanity check readability
+		if err := ensureFile(p); err != nil {
+			if strict {
+				return nil, fmt.Errorf("image unreadable: %s (%w)", p, err)
 			}
+			log.Printf("skipping image %s: %v", p, err)
+			continue
 		}
-		os.Exit(0)
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func normalizeLabel(label string) string {
+	s := strings.TrimSpace(label)
+	s = strings.ReplaceAll(s, ", ", "-")
+	s = strings.ReplaceAll(s, ",", "-")
+	s = strings.ReplaceAll(s, "–", "-")
+	// remove all spaces for filenames
+	s = strings.ReplaceAll(s, " ", "")
+	return s
+}
+
+func existsFile(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir()
+}
+
+// ===================== Dry run =====================
+
+// dryRunPreview is what a real run would post, without any network calls.
+type dryRunPreview struct {
+	Label         string   `json:"label"`
+	Status        string   `json:"status"`
+	Length        int      `json:"length"`
+	Images        []string `json:"images"`
+	WouldTruncate bool     `json:"would_truncate"`
+	// ImageChecks reports on every image found for the verse, including
+	// those Images leaves out as unusable.
+	ImageChecks []imageCheck `json:"image_checks,omitempty"`
+}
+
+// imageCheck is the dry-run verdict on one image: whether a real run could
+// upload it.
+type imageCheck struct {
+	Path        string `json:"path"`
+	Exists      bool   `json:"exists"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+	OverLimit   bool   `json:"over_limit"`
+	Problem     string `json:"problem,omitempty"` // empty when the image is fine
+}
+
+// checkImages validates each image as the upload would: readable, a
+// supported media type, and no larger than max bytes.
+func checkImages(paths []string, max int64) []imageCheck {
+	checks := make([]imageCheck, 0, len(paths))
+	for _, p := range paths {
+		checks = append(checks, checkImage(p, max))
+	}
+	return checks
+}
+
+func checkImage(path string, max int64) imageCheck {
+	c := imageCheck{Path: path}
+	if err := ensureFile(path); err != nil {
+		c.Problem = err.Error()
+		return c
+	}
+	c.Exists = true
+	f, err := os.Open(path)
+	if err != nil {
+		c.Problem = err.Error()
+		return c
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		c.Problem = err.Error()
+		return c
+	}
+	c.Size = fi.Size()
+	mediaType, _, err := sniffMedia(f)
+	c.ContentType = mediaType
+	switch {
+	case err != nil:
+		c.Problem = err.Error()
+	case c.Size > max:
+		c.OverLimit = true
+		c.Problem = fmt.Sprintf("%s, over the %s upload limit", formatSize(c.Size), formatSize(max))
+	}
+	return c
+}
+
+func newDryRunPreview(t *model.Text, o statusOptions) dryRunPreview {
+	status, truncated := renderStatus(t, o)
+	images := t.Images
+	if images == nil {
+		images = []string{}
+	}
+	return dryRunPreview{
+		Label:         t.Label,
+		Status:        status,
+		Length:        runeLen(status),
+		Images:        images,
+		WouldTruncate: truncated,
+	}
+}
+
+func printDryRunPreview(w io.Writer, p dryRunPreview) {
+	fmt.Fprintln(w, "DRY RUN ✅ (no network calls)")
+	fmt.Fprintf(w, "Status:\n---\n%s\n---\n", p.Status)
+	if len(p.ImageChecks) > 0 {
+		fmt.Fprintln(w, "Images:")
+		for _, c := range p.ImageChecks {
+			if c.Problem != "" {
+				fmt.Fprintf(w, " ✗ %s: %s\n", c.Path, c.Problem)
+				continue
+			}
+			fmt.Fprintf(w, " ✓ %s: %s %s\n", c.Path, formatSize(c.Size), c.ContentType)
+		}
+		return
+	}
+	if len(p.Images) == 0 {
+		fmt.Fprintln(w, "Images: (none)")
+		return
+	}
+	fmt.Fprintln(w, "Images:")
+	for _, img := range p.Images {
+		fmt.Fprintln(w, " -", img)
+	}
+}
+
+func writeDryRunPreview(path string, p dryRunPreview) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// printStatus writes just the status r would post for the next selected
+// verse, images resolved as for posting, for piping into other tools.
+func printStatus(ctx context.Context, w io.Writer, r *runner) error {
+	t, err := r.next(ctx)
+	if err != nil {
+		return err
+	}
+	status, _ := renderStatus(t, r.status)
+	_, err = fmt.Fprintln(w, status)
+	return err
+}
+
+// ===================== Status text =====================
+
+func formatStatus(label, body string) string {
+	status, _ := renderStatus(&model.Text{Label: label, Body: body}, statusOptions{})
+	return status
+}
+
+// statusOptions tunes renderStatus; the zero value is the default format.
+type statusOptions struct {
+	Bilingual      bool   // append the Pāli, when known, after the translation
+	ChapterHashtag bool   // add a CamelCased hashtag of the chapter, when known
+	MaxLen         int    // length budget in runes; 0 means xMaxLen
+	MaxBodyChars   int    // cut the verse body to this many runes first; 0 means no cap
+	LabelPrefix    string // word before the label in the header, e.g. "Dhp"; "" for none
+	Ellipsis       string // marks a cut body; "" means "…"
+	AttributionSep string // before the attribution; "" means "—"
+	TextInAlt      bool   // verses with images: body only in the first image's alt text
+	NoHashtags     bool   // leave out the hashtags, chapter hashtag included
+	NoAttribution  bool   // leave out the separator and attribution
+	StripVerseNum  bool   // drop a stray next-verse number from the end of the body
+	Pretty         bool   // label, body, attribution and hashtags each on their own line
+}
+
+// xMaxLen is X's limit on a post, in runes; xPremiumMaxLen is the limit for
+// premium accounts, the most -max-len allows on X.
+const (
+	xMaxLen        = 280
+	xPremiumMaxLen = 25000
+)
+
+// checkMaxLen rejects a -max-len above what platform accepts in one post
+// (for X, what premium accounts accept), which would fail every long post.
+func checkMaxLen(platform string, maxLen int) error {
+	limit := xPremiumMaxLen
+	switch platform {
+	case platformDiscord:
+		limit = discordMaxLen
+	case platformTelegram:
+		limit = telegramMaxLen
+	}
+	if maxLen > limit {
+		return fmt.Errorf("-max-len %d exceeds the limit of %d for -platform %s", maxLen, limit, platform)
+	}
+	return nil
+}
+
+// checkXOnlyFlags rejects flags that only the X poster acts on when another
+// platform is selected, rather than posting without them.
+func checkXOnlyFlags(cfg *config) error {
+	if cfg.platform == platformX {
+		return nil
+	}
+	var name string
+	switch {
+	case !cfg.scheduleAt.IsZero():
+		name = "-schedule-at"
+	case cfg.pollOpts != "":
+		name = "-poll"
+	case cfg.upload.Mode != "":
+		name = "-upload-mode"
+	case cfg.upload.Concurrency > 1:
+		name = "-upload-concurrency"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s is not supported with -platform %s", name, cfg.platform)
+}
+
+// defaultAttribution credits verses with no translator attribution.
+const defaultAttribution = "Dhammapada (F Max Müller)"
+
+// paliSep introduces the Pāli on its own line in bilingual posts.
+const paliSep = "\nPāli: "
+
+// renderStatus builds the status text and reports whether the body had to be
+// truncated to fit. In bilingual mode the translation is truncated first; the
+// Pāli is only shortened if even a minimal translation leaves no room for it.
+func renderStatus(t *model.Text, o statusOptions) (string, bool) {
+	const minBody = 20
+	maxLen := o.MaxLen
+	if maxLen <= 0 {
+		maxLen = xMaxLen
+	}
+	label := t.Label
+	if o.LabelPrefix != "" {
+		label = o.LabelPrefix + " " + t.Label
+	}
+	header := label + ": "
+	attributionSep := " " + cmp.Or(o.AttributionSep, "—") + " "
+	hashtagSep := " "
+	if o.Pretty {
+		header, attributionSep, hashtagSep = label+"\n", "\n", "\n"
+	}
+	tail := ""
+	if !o.NoAttribution {
+		tail += attributionSep + cmp.Or(t.Attribution, defaultAttribution)
+	}
+	if !o.NoHashtags {
+		hashtags := defaultHashtags
+		if o.ChapterHashtag {
+			hashtags = addHashtag(hashtags, chapterHashtag(t.Chapter))
+		}
+		tail += hashtagSep + hashtags
+	}
+	if altText(t, o) != "" {
+		// The body travels as alt text: post just the label and the tail.
+		return label + tail, false
+	}
+	body := strings.TrimSpace(t.Body)
+	if o.StripVerseNum {
+		body = stripNextVerseNumber(body, t.Label)
+	}
+	pali := strings.TrimSpace(t.Pali)
+	extra := ""
+	if o.Bilingual && pali != "" {
+		extra = paliSep + pali
+	}
+
+	ellipsis := cmp.Or(o.Ellipsis, "…")
+	capped := false
+	if o.MaxBodyChars > 0 && runeLen(body) > o.MaxBodyChars {
+		body, capped = truncateAtWord(body, o.MaxBodyChars), true
+	}
+
+	text := header + body + extra + tail
+	if capped {
+		text = header + body + ellipsis + extra + tail
+	}
+	if runeLen(text) <= maxLen {
+		return text, capped
+	}
+	avail := maxLen - runeLen(header) - runeLen(extra) - runeLen(tail) - runeLen(ellipsis)
+	if avail >= minBody || extra == "" {
+		if avail < minBody {
+			avail = minBody
+		}
+		trunc := truncateRunes(body, avail)
+		return header + trunc + ellipsis + extra + tail, true
+	}
+
+	// Not even minBody runes of translation fit beside the full Pāli: keep
+	// that much translation and trim the Pāli into the remaining room.
+	if runeLen(body) > minBody {
+		body = truncateRunes(body, minBody) + ellipsis
+	}
+	room := maxLen - runeLen(header) - runeLen(body) - runeLen(paliSep) - runeLen(ellipsis) - runeLen(tail)
+	extra = ""
+	if room > 0 {
+		extra = paliSep + truncateRunes(pali, room) + ellipsis
+	}
+	return header + body + extra + tail, true
+}
+
+var (
+	lastNumber     = regexp.MustCompile(`([0-9]+)[^0-9]*$`)
+	trailingNumber = regexp.MustCompile(`\s+([0-9]+)$`)
+)
+
+// stripNextVerseNumber removes a number OCR leaked onto the end of a body
+// from the next verse's marker, e.g. the "11" ending verse 10. Only a
+// standalone number equal to the one after the label's last verse is
+// removed, so numbers that belong to the text are kept.
+func stripNextVerseNumber(body, label string) string {
+	m := lastNumber.FindStringSubmatch(label)
+	if m == nil {
+		return body
+	}
+	last, err := strconv.Atoi(m[1])
+	if err != nil {
+		return body
+	}
+	loc := trailingNumber.FindStringSubmatchIndex(body)
+	if loc == nil || body[loc[2]:loc[3]] != strconv.Itoa(last+1) {
+		return body
+	}
+	return body[:loc[0]]
+}
+
+// altText is the alt text for a verse's first image: the body in -text-in-alt
+// mode when the verse has images, otherwise "".
+func altText(t *model.Text, o statusOptions) string {
+	if !o.TextInAlt || len(t.Images) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(t.Body)
+}
+
+const defaultHashtags = "#dhammapada #buddha #siddharthagautama"
+
+// chapterHashtag CamelCases a chapter name into a hashtag, e.g.
+// "Twin Verses" → "#TwinVerses". It returns "" for an empty name.
+func chapterHashtag(chapter string) string {
+	words := strings.FieldsFunc(chapter, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('#')
+	for _, w := range words {
+		rs := []rune(w)
+		b.WriteRune(unicode.ToUpper(rs[0]))
+		b.WriteString(string(rs[1:]))
+	}
+	return b.String()
+}
+
+// addHashtag appends tag to the space-separated tags unless it is empty or
+// already present (compared case-insensitively).
+func addHashtag(tags, tag string) string {
+	if tag == "" {
+		return tags
+	}
+	for _, t := range strings.Fields(tags) {
+		if strings.EqualFold(t, tag) {
+			return tags
+		}
+	}
+	return tags + " " + tag
+}
+
+// truncateAtWord cuts s to at most n runes, backing up to the last space so
+// no word is split (unless the first word alone is longer than n).
+func truncateAtWord(s string, n int) string {
+	rs := []rune(s)
+	if n >= len(rs) {
+		return s
+	}
+	cut := n
+	if !unicode.IsSpace(rs[n]) {
+		for cut > 0 && !unicode.IsSpace(rs[cut-1]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = n
+		}
+	}
+	return strings.TrimRightFunc(string(rs[:cut]), unicode.IsSpace)
+}
+
+func runeLen(s string) int { return len([]rune(s)) }
+func truncateRunes(s string, n int) string {
+	rs := []rune(s)
+	if n >= len(rs) {
+		return s
+	}
+	return string(rs[:n])
+}
+
+// ===================== Files =====================
+
+func ensureFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("path is a directory, not a file: %s", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _ = f.Read(make([]byte, 1)) // permission sanity check
+	return nil
+}
+
+// ===================== X (Twitter) error diagnostics =====================
+
+type xErrorV2 struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Type   string `json:"type"`
+}
+
+type xErrorV1 struct {
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func diagnoseHTTPError(resp *http.Response, body []byte, endpoint string) string {
+	access := resp.Header.Get("x-access-level")
+	rateL := resp.Header.Get("x-rate-limit-limit")
+	rateR := resp.Header.Get("x-rate-limit-remaining")
+	rateT := resp.Header.Get("x-rate-limit-reset")
+	txid := resp.Header.Get("x-transaction-id")
+	xtime := resp.Header.Get("x-response-time")
+
+	var msg string
+	// Try v2-style error first.
+	var v2 xErrorV2
+	var v1 xErrorV1
+	if json.Unmarshal(body, &v2) == nil && (v2.Title != "" || v2.Detail != "") {
+		msg = fmt.Sprintf("%s %d: %s | %s | type=%s | x-access-level=%s x-rate-limit=%s/%s reset=%s txid=%s rtime=%s | body=%s",
+			endpoint, resp.StatusCode, v2.Title, v2.Detail, v2.Type, access, rateR, rateL, rateT, txid, xtime, string(body))
+	} else if json.Unmarshal(body, &v1) == nil && len(v1.Errors) > 0 {
+		// Try v1.1-style error array.
+		var parts []string
+		for _, e := range v1.Errors {
+			parts = append(parts, fmt.Sprintf("code=%d msg=%q", e.Code, e.Message))
+		}
+		msg = fmt.Sprintf("%s %d: %s | x-access-level=%s x-rate-limit=%s/%s reset=%s txid=%s rtime=%s | body=%s",
+			endpoint, resp.StatusCode, strings.Join(parts, "; "), access, rateR, rateL, rateT, txid, xtime, string(body))
+	} else {
+		// Fallback.
+		msg = fmt.Sprintf("%s %d: x-access-level=%s x-rate-limit=%s/%s reset=%s txid=%s rtime=%s | body=%s",
+			endpoint, resp.StatusCode, access, rateR, rateL, rateT, txid, xtime, string(body))
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		msg += " | " + rateLimitHint(resp.Header)
+	}
+	return msg
+}
+
+// rateLimitHint summarises the rate-limit headers of a 429 response, turning
+// the epoch-seconds reset value into a wall-clock time operators can act on.
+func rateLimitHint(h http.Header) string {
+	hint := fmt.Sprintf("rate limited: limit=%s remaining=%s",
+		h.Get("x-rate-limit-limit"), h.Get("x-rate-limit-remaining"))
+	if reset, ok := rateLimitReset(h); ok {
+		hint += fmt.Sprintf(" retry after %s", reset.UTC().Format("2006-01-02 15:04:05 MST"))
+	}
+	return hint
+}
+
+// rateLimitReset parses x-rate-limit-reset (Unix seconds).
+func rateLimitReset(h http.Header) (time.Time, bool) {
+	v := strings.TrimSpace(h.Get("x-rate-limit-reset"))
+	if v == "" {
+		return time.Time{}, false
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(secs, 0), true
+}
+
+// APIError is a non-2xx response from X. Its message carries the
+// diagnostics from diagnoseHTTPError; the more specific errors below wrap it.
+type APIError struct {
+	StatusCode int
+	Body       string
+	msg        string
+}
+
+func (e *APIError) Error() string { return e.msg }
+
+// RateLimitError is returned for a 429 response; Reset is when the window
+// reopens (zero if the response did not say).
+type RateLimitError struct {
+	*APIError
+	Reset time.Time
+}
+
+func (e *RateLimitError) Unwrap() error { return e.APIError }
+
+// AuthError is returned for a 401: the credentials were rejected.
+type AuthError struct{ *APIError }
+
+func (e *AuthError) Unwrap() error { return e.APIError }
+
+// DuplicateError is returned when X refuses a tweet as duplicate content.
+type DuplicateError struct{ *APIError }
+
+func (e *DuplicateError) Unwrap() error { return e.APIError }
+
+// httpError turns a non-2xx response into a typed error carrying the
+// diagnostics: *RateLimitError, *AuthError, *DuplicateError, or else
+// *APIError.
+func httpError(resp *http.Response, body []byte, endpoint string) error {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		msg:        diagnoseHTTPError(resp, body, endpoint),
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		reset, _ := rateLimitReset(resp.Header)
+		return &RateLimitError{APIError: apiErr, Reset: reset}
+	case resp.StatusCode == http.StatusUnauthorized:
+		return &AuthError{apiErr}
+	case isDuplicate(body):
+		return &DuplicateError{apiErr}
+	}
+	return apiErr
+}
+
+// xDuplicateCode is the v1.1 error code for "Status is a duplicate".
+const xDuplicateCode = 187
+
+// isDuplicate reports whether an error body is X's duplicate-content
+// rejection, in either the v2 or the v1.1 shape.
+func isDuplicate(body []byte) bool {
+	var v2 xErrorV2
+	if json.Unmarshal(body, &v2) == nil && strings.Contains(strings.ToLower(v2.Detail), "duplicate content") {
+		return true
+	}
+	var v1 xErrorV1
+	if json.Unmarshal(body, &v1) == nil {
+		for _, e := range v1.Errors {
+			if e.Code == xDuplicateCode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ===================== X (Twitter) =====================
+
+// Poster publishes a rendered status, with optional images, and returns the
+// platform's id for the new post.
+type Poster interface {
+	Post(ctx context.Context, status string, images []string) (string, error)
+}
+
+// threadPoster is a Poster that can also post as a reply, as -chain needs.
+type threadPoster interface {
+	Poster
+	PostReply(ctx context.Context, status string, images []string, inReplyTo string) (string, error)
+}
+
+// deleterPoster is a Poster that can also delete a post, as -edit needs.
+type deleterPoster interface {
+	Poster
+	Delete(ctx context.Context, id string) error
+}
+
+// mediaLimiter is a Poster that takes at most maxMedia images per post.
+type mediaLimiter interface {
+	maxMedia() int
+}
+
+// altTextPoster is a threadPoster that can also set the first image's alt
+// text, as -text-in-alt needs.
+type altTextPoster interface {
+	threadPoster
+	PostWithAlt(ctx context.Context, status string, images []string, inReplyTo, alt string) (string, error)
+}
+
+// Platforms selectable with -platform.
+const (
+	platformX        = "x"
+	platformDiscord  = "discord"
+	platformTelegram = "telegram"
+)
+
+// xPoster posts to X: images via v1.1 media/upload, the status via v2 tweets.
+type xPoster struct {
+	client   *http.Client
+	poll     *model.TweetPoll // optional poll attached to every post
+	upload   uploadOptions
+	schedule *xSchedule // when set, posts are scheduled instead of published
+	media    mediaCache // uploads made this run, by path
+}
+
+// xMaxMedia is how many images X allows on one post.
+const xMaxMedia = 4
+
+func (p *xPoster) maxMedia() int { return cmp.Or(p.upload.MaxMedia, xMaxMedia) }
+
+func (p *xPoster) Post(ctx context.Context, status string, images []string) (string, error) {
+	return p.PostReply(ctx, status, images, "")
+}
+
+// PostReply posts like Post, as a reply to inReplyTo when it is non-empty.
+func (p *xPoster) PostReply(ctx context.Context, status string, images []string, inReplyTo string) (string, error) {
+	return p.PostWithAlt(ctx, status, images, inReplyTo, "")
+}
+
+// PostWithAlt posts like PostReply, setting alt as the first image's alt text
+// when both are non-empty.
+func (p *xPoster) PostWithAlt(ctx context.Context, status string, images []string, inReplyTo, alt string) (string, error) {
+	if p.poll != nil && len(images) > 0 {
+		return "", errPollWithMedia
+	}
+	if p.schedule != nil {
+		if inReplyTo != "" || p.poll != nil {
+			return "", errors.New("scheduled tweets cannot be replies or polls")
+		}
+		if err := p.schedule.check(time.Now()); err != nil {
+			return "", err
+		}
+	}
+	if p.media == nil {
+		p.media = mediaCache{}
+	}
+	// --- uploads up to upload.MaxMedia images, reusing this run's uploads ---
+	mediaIDs, err := p.uploadWithAlt(images, alt)
+	if err != nil {
+		return "", err
+	}
+	if p.schedule != nil {
+		return scheduleTweet(p.client, *p.schedule, status, mediaIDs)
+	}
+	// --- creates tweet (v2) with media ---
+	opts := tweetOptions{InReplyTo: inReplyTo, Poll: p.poll}
+	id, err := createTweetV2(p.client, status, mediaIDs, opts)
+	if err != nil && len(mediaIDs) > 0 && isInvalidMedia(err) {
+		// A cached id has expired after all: upload afresh and try once more.
+		p.media.forget(images)
+		if mediaIDs, err = p.uploadWithAlt(images, alt); err != nil {
+			return "", err
+		}
+		id, err = createTweetV2(p.client, status, mediaIDs, opts)
+	}
+	return id, err
+}
+
+// Delete deletes the tweet with the given id; see deleteTweetV2.
+func (p *xPoster) Delete(ctx context.Context, id string) error {
+	return deleteTweetV2(p.client, id)
+}
+
+// errAltTextLost reports that no image uploaded to carry the alt text (with
+// -best-effort-media every upload can fail without an error); nothing was
+// posted.
+var errAltTextLost = errors.New("no image uploaded to carry the alt text")
+
+// uploadWithAlt uploads images (reusing this run's uploads) and sets alt on
+// the first one.
+func (p *xPoster) uploadWithAlt(images []string, alt string) ([]string, error) {
+	mediaIDs, err := uploadImagesCached(p.client, images, p.upload, p.media)
+	if err != nil || alt == "" {
+		return mediaIDs, err
+	}
+	if len(mediaIDs) == 0 {
+		return nil, errAltTextLost
+	}
+	if err := setMediaAltText(p.client, mediaIDs[0], alt); err != nil {
+		return nil, fmt.Errorf("setting alt text: %w", err)
+	}
+	return mediaIDs, nil
+}
+
+// mediaCache remembers the media ids uploaded during a run by image path, so
+// a retried post does not upload the same images again.
+type mediaCache map[string]cachedMedia
+
+type cachedMedia struct {
+	id string
+	at time.Time
+}
+
+// mediaIDTTL is how long X keeps an uploaded media id usable; cached ids are
+// reused for a little less than that.
+const mediaIDTTL = 23 * time.Hour
+
+func (c mediaCache) get(path string) (string, bool) {
+	m, ok := c[path]
+	if !ok || time.Since(m.at) > mediaIDTTL {
+		return "", false
+	}
+	return m.id, true
+}
+
+func (c mediaCache) forget(paths []string) {
+	for _, p := range paths {
+		delete(c, p)
+	}
+}
+
+// isInvalidMedia reports whether X rejected a tweet for an invalid or
+// expired media id.
+func isInvalidMedia(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(apiErr.Body)
+	return strings.Contains(body, "media") && strings.Contains(body, "invalid")
+}
+
+var errPollWithMedia = errors.New("a tweet cannot have both a poll and media")
+
+// parsePoll builds a poll from comma-separated options; empty means no poll.
+// X requires 2–4 options of at most 25 characters, open for 5–10080 minutes.
+func parsePoll(options string, minutes int) (*model.TweetPoll, error) {
+	if strings.TrimSpace(options) == "" {
+		return nil, nil
+	}
+	var opts []string
+	for _, o := range strings.Split(options, ",") {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		if runeLen(o) > 25 {
+			return nil, fmt.Errorf("poll option %q is longer than 25 characters", o)
+		}
+		opts = append(opts, o)
+	}
+	if len(opts) < 2 || len(opts) > 4 {
+		return nil, fmt.Errorf("poll needs 2 to 4 options, got %d", len(opts))
+	}
+	if minutes < 5 || minutes > 10080 {
+		return nil, fmt.Errorf("poll duration must be 5–10080 minutes, got %d", minutes)
+	}
+	return &model.TweetPoll{Options: opts, DurationMinutes: minutes}, nil
+}
+
+// OAuth1 user-context HTTP client
+func newOAuth1HTTPClient(consumerKey, consumerSecret, accessToken, accessSecret string) *http.Client {
+	cfg := oauth1.NewConfig(consumerKey, consumerSecret)
+	tok := oauth1.NewToken(accessToken, accessSecret)
+	ctx := context.WithValue(context.Background(), oauth1.HTTPClient, &http.Client{Transport: httpTransport})
+	return cfg.Client(ctx, tok)
+}
+
+// verifyCredentials confirms the OAuth1 credentials by fetching the
+// authenticated user, returning its handle.
+func verifyCredentials(httpClient *http.Client) (string, error) {
+	u, err := fetchMe(httpClient)
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+// fetchMe returns the authenticated user from GET /2/users/me.
+func fetchMe(httpClient *http.Client) (user struct{ ID, Username string }, err error) {
+	req, err := http.NewRequest("GET", "https://api.twitter.com/2/users/me", nil)
+	if err != nil {
+		return user, err
 	}
 
-	// --- OAuth1 user-context HTTP client ---
-	httpClient := newOAuth1HTTPClient(ck, cs, at, as)
-
-	// --- uploads up to 4 images ---
-	mediaIDs, err := uploadImages(httpClient, t.Images)
-	must(err)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return user, err
+	}
+	defer resp.Body.Close()
 
-	// --- creates tweet (v2) with media ---
-	tweetID, err := createTweetV2(httpClient, status, mediaIDs)
-	must(err)
-	log.Printf("Posted tweet ID %s", tweetID)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return user, httpError(resp, b, "GET /2/users/me")
+	}
 
-	// --- marks as posted ---
-	_, err = db.ExecContext(context.Background(),
-		`UPDATE texts SET posted_at = CURRENT_TIMESTAMP, x_post_id = ? WHERE id = ?`,
-		tweetID, t.ID)
-	must(err)
+	var r model.UserResp
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return user, err
+	}
+	if r.Data.Username == "" {
+		return user, fmt.Errorf("verify credentials: missing username in response")
+	}
+	user.ID, user.Username = r.Data.ID, r.Data.Username
+	return user, nil
+}
 
-	log.Printf("Marked text_id=%d (label=%s) as posted at %s", t.ID, t.Label, time.Now().Format(time.RFC3339))
+// uploadOptions tunes uploadImages; the zero value uploads up to xMaxMedia
+// images of at most xMaxUploadSize bytes and fails on the first error.
+type uploadOptions struct {
+	MaxMedia    int    // images per post; 0 means xMaxMedia
+	BestEffort  bool   // skip images that fail to upload instead of failing
+	SimpleLimit int64  // largest file sent in one request; 0 means xSimpleUploadLimit
+	MaxSize     int64  // largest file accepted at all; 0 means xMaxUploadSize
+	Sensitive   bool   // mark each image as sensitive media (shown behind a warning)
+	Concurrency int    // uploads in flight at once; 0 or 1 uploads one at a time
+	Mode        string // uploadAuto (or ""), uploadSimple or uploadChunked
 }
 
-// ===================== DB + image derivation =====================
+// X accepts images up to 5MB, and the simple (single-request) upload
+// handles files of that size.
+const (
+	xSimpleUploadLimit = 5 << 20
+	xMaxUploadSize     = 5 << 20
+	uploadChunkSize    = 1 << 20
+)
 
-func getRandomUnpostedTextAndImages(ctx context.Context, db *sql.DB) (*model.Text, error) {
-	const pick = `
-SELECT id, label, text_body
-FROM texts
-WHERE posted_at IS NULL
-ORDER BY RANDOM()
-LIMIT 1;
-`
-	t := &model.Text{}
-	if err := db.QueryRowContext(ctx, pick).Scan(&t.ID, &t.Label, &t.Body); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("no unposted texts remain")
-		}
-		return nil, err
+func (o uploadOptions) limits() (simple, max int64) {
+	simple, max = o.SimpleLimit, o.MaxSize
+	if simple <= 0 {
+		simple = xSimpleUploadLimit
 	}
-
-	paths, err := deriveImagePaths(t.Label)
-	if err != nil {
-		return nil, err
+	if max <= 0 {
+		max = xMaxUploadSize
 	}
-	t.Images = paths
-	return t, nil
+	return simple, max
 }
 
-// deriveImagePaths returns up to 4 existing image paths based on the label.
-//
-// Conventions supported (in order):
-//
-//	images/<norm>.jpg|.png|.webp
-//	images/<norm>-1.jpg|.png|.webp
-//	images/<norm>-2.jpg|.png|.webp
-//	images/<norm>-3.jpg|.png|.webp
-//	images/<norm>-4.jpg|.png|.webp
-//
-// where <norm> is the label normalized:
-//   - ", " and "," -> "-" (e.g., "58, 59" -> "58-59")
-//   - "–" (en dash) -> "-"
-//   - spaces removed
-func deriveImagePaths(label string) ([]string, error) {
-	norm := normalizeLabel(label)
-	dir := "images"
-
-	var candidates []string
-	add := func(stem string) {
-		candidates = append(candidates,
-			filepath.Join(dir, stem+".jpg"),
-			filepath.Join(dir, stem+".png"),
-			filepath.Join(dir, stem+".webp"),
-		)
-	}
-	add(norm)
-	add(norm + "-1")
-	add(norm + "-2")
-	add(norm + "-3")
-	add(norm + "-4")
+// Uploads multiple images, returning media_id strings. Files over the simple
+// limit go through the chunked upload; files over the hard max are rejected.
+func uploadImages(httpClient *http.Client, paths []string, opts uploadOptions) ([]string, error) {
+	return uploadImagesCached(httpClient, paths, opts, nil)
+}
 
-	var out []string
-	seen := map[string]bool{}
-	for _, p := range candidates {
-		if existsFile(p) && !seen[p] {
-			// sanity check readability
-			if err := ensureFile(p); err != nil {
-				return nil, fmt.Errorf("image unreadable: %s (%w)", p, err)
+// uploadImagesCached is uploadImages, taking ids from cache (when non-nil)
+// for images already uploaded and adding new uploads to it.
+func uploadImagesCached(httpClient *http.Client, paths []string, opts uploadOptions, cache mediaCache) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	maxMedia := opts.MaxMedia
+	if maxMedia <= 0 {
+		maxMedia = xMaxMedia
+	}
+	if len(paths) > maxMedia {
+		paths = paths[:maxMedia]
+	}
+	results := uploadAll(httpClient, paths, opts, cache)
+
+	ids := make([]string, 0, len(paths))
+	var failed []error
+	for i, p := range paths {
+		id, err := results[i].id, results[i].err
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				continue // another upload failed first
 			}
-			out = append(out, p)
-			seen[p] = true
-			if len(out) == 4 { // X cap
-				break
+			err = fmt.Errorf("upload %s: %w", p, err)
+			if !opts.BestEffort {
+				return nil, err
 			}
+			log.Printf("skipping image: %v", err)
+			failed = append(failed, err)
+			continue
+		}
+		if cache != nil {
+			cache[p] = cachedMedia{id: id, at: time.Now()}
 		}
+		ids = append(ids, id)
 	}
-	// ok if zero images; tweet will be text-only
-	return out, nil
-}
-
-func normalizeLabel(label string) string {
-	s := strings.TrimSpace(label)
-	s = strings.ReplaceAll(s, ", ", "-")
-	s = strings.ReplaceAll(s, ",", "-")
-	s = strings.ReplaceAll(s, "–", "-")
-	// remove all spaces for filenames
-	s = strings.ReplaceAll(s, " ", "")
-	return s
+	if len(failed) > 0 {
+		log.Printf("%d of %d image upload(s) failed; posting with %d", len(failed), len(paths), len(ids))
+	}
+	return ids, nil
 }
 
-func existsFile(p string) bool {
-	fi, err := os.Stat(p)
-	return err == nil && !fi.IsDir()
+type uploadResult struct {
+	id  string
+	err error
 }
 
-// ===================== Status text =====================
+// uploadAll uploads the uncached paths with up to opts.Concurrency workers,
+// returning one result per path in the original order. Unless best effort is
+// set, the first failure cancels the other uploads, including any in flight.
+func uploadAll(httpClient *http.Client, paths []string, opts uploadOptions, cache mediaCache) []uploadResult {
+	results := make([]uploadResult, len(paths))
+	var pending []int
+	for i, p := range paths {
+		if id, ok := cache.get(p); ok {
+			results[i].id = id
+			continue
+		}
+		pending = append(pending, i)
+	}
 
-func formatStatus(label, body string) string {
-	const (
-		attribution = "— Dhammapada (F Max Müller)"
-		hashtags    = "#dhammapada #buddha #siddharthagautama"
-		maxLen      = 280
-	)
-	header := fmt.Sprintf("%s: ", label)
-	tail := " " + attribution + " " + hashtags
-	body = strings.TrimSpace(body)
-
-	text := header + body + tail
-	if runeLen(text) <= maxLen {
-		return text
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(opts.Concurrency, 1), len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					results[i].err = ctx.Err()
+					continue
+				}
+				id, err := uploadMedia(ctx, httpClient, paths[i], opts)
+				results[i] = uploadResult{id, err}
+				if err != nil && !opts.BestEffort {
+					cancel()
+				}
+			}
+		}()
 	}
-	ellipsis := "…"
-	avail := maxLen - runeLen(header) - runeLen(tail) - runeLen(ellipsis)
-	if avail < 20 {
-		avail = 20
+	for _, i := range pending {
+		jobs <- i
 	}
-	trunc := truncateRunes(body, avail)
-	return header + trunc + ellipsis + tail
+	close(jobs)
+	wg.Wait()
+	return results
 }
 
-func runeLen(s string) int { return len([]rune(s)) }
-func truncateRunes(s string, n int) string {
-	rs := []rune(s)
-	if n >= len(rs) {
-		return s
+// uploadMedia picks the simple or chunked upload for one file by its size.
+func uploadMedia(ctx context.Context, httpClient *http.Client, imagePath string, opts uploadOptions) (string, error) {
+	fi, err := os.Stat(imagePath)
+	if err != nil {
+		return "", err
 	}
-	return string(rs[:n])
+	mode, err := uploadModeFor(fi.Size(), opts)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	if mode == uploadChunked {
+		id, err = uploadMediaChunked(ctx, httpClient, imagePath)
+	} else {
+		id, err = uploadMediaSimple(ctx, httpClient, imagePath)
+	}
+	if err != nil || !opts.Sensitive {
+		return id, err
+	}
+	return id, markMediaSensitive(httpClient, id)
 }
 
-// ===================== Files =====================
+// markMediaSensitive flags uploaded media with a sensitive-media warning via
+// media/metadata/create. The v2 create-tweet request has no such flag.
+func markMediaSensitive(httpClient *http.Client, mediaID string) error {
+	return createMediaMetadata(httpClient, model.MediaMetadataReq{
+		MediaID:               mediaID,
+		SensitiveMediaWarning: []string{"other"},
+	})
+}
 
-func ensureFile(path string) error {
-	fi, err := os.Stat(path)
+// xMaxAltText is X's limit on image alt text, in runes.
+const xMaxAltText = 1000
+
+// setMediaAltText sets the alt text of an uploaded image, shortened to X's
+// limit.
+func setMediaAltText(httpClient *http.Client, mediaID, text string) error {
+	return createMediaMetadata(httpClient, model.MediaMetadataReq{
+		MediaID: mediaID,
+		AltText: &model.MediaAltText{Text: truncateAltText(text, xMaxAltText)},
+	})
+}
+
+// truncateAltText fits alt text into a backend's limit of max runes, cutting
+// at a word and marking the cut with an ellipsis.
+func truncateAltText(text string, max int) string {
+	if runeLen(text) <= max {
+		return text
+	}
+	return truncateAtWord(text, max-1) + "…"
+}
+
+func createMediaMetadata(httpClient *http.Client, meta model.MediaMetadataReq) error {
+	body, err := json.Marshal(meta)
 	if err != nil {
 		return err
 	}
-	if fi.IsDir() {
-		return fmt.Errorf("path is a directory, not a file: %s", path)
+	req, err := http.NewRequest("POST", "https://upload.twitter.com/1.1/media/metadata/create.json", bytes.NewReader(body))
+	if err != nil {
+		return err
 	}
-	f, err := os.Open(path)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	_, _ = f.Read(make([]byte, 1)) // permission sanity check
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return httpError(resp, b, "POST /1.1/media/metadata/create.json")
+	}
 	return nil
 }
 
-// ===================== X (Twitter) error diagnostics =====================
+// Upload modes for -upload-mode.
+const (
+	uploadAuto    = "auto"
+	uploadSimple  = "simple"
+	uploadChunked = "chunked"
+)
 
-type xErrorV2 struct {
-	Title  string `json:"title"`
-	Detail string `json:"detail"`
-	Type   string `json:"type"`
+// uploadModeFor decides how a file of size bytes is uploaded: opts.Mode when
+// forced, otherwise simple up to the simple limit and chunked above it.
+func uploadModeFor(size int64, opts uploadOptions) (string, error) {
+	simple, max := opts.limits()
+	if size > max {
+		return "", fmt.Errorf("file is %s, over the %s upload limit", formatSize(size), formatSize(max))
+	}
+	switch opts.Mode {
+	case uploadSimple:
+		if size > simple {
+			return "", fmt.Errorf("file is %s, over the %s simple upload limit; use -upload-mode chunked or auto",
+				formatSize(size), formatSize(simple))
+		}
+		return uploadSimple, nil
+	case uploadChunked:
+		return uploadChunked, nil
+	case "", uploadAuto:
+		if size > simple {
+			return uploadChunked, nil
+		}
+		return uploadSimple, nil
+	}
+	return "", fmt.Errorf("unknown upload mode %q", opts.Mode)
 }
 
-type xErrorV1 struct {
-	Errors []struct {
-		Code    int    `json:"code"`
-		Message string `json:"message"`
-	} `json:"errors"`
+// formatSize renders a byte count in MB for error messages.
+func formatSize(n int64) string {
+	return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
 }
 
-func diagnoseHTTPError(resp *http.Response, body []byte, endpoint string) string {
-	access := resp.Header.Get("x-access-level")
-	rateL := resp.Header.Get("x-rate-limit-limit")
-	rateR := resp.Header.Get("x-rate-limit-remaining")
-	rateT := resp.Header.Get("x-rate-limit-reset")
-	txid := resp.Header.Get("x-transaction-id")
-	xtime := resp.Header.Get("x-response-time")
+func uploadMediaSimple(ctx context.Context, httpClient *http.Client, imagePath string) (string, error) {
+	// Endpoint: https://upload.twitter.com/1.1/media/upload.json
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-	// Try v2-style error first.
-	var v2 xErrorV2
-	if json.Unmarshal(body, &v2) == nil && (v2.Title != "" || v2.Detail != "") {
-		return fmt.Sprintf("%s %d: %s | %s | type=%s | x-access-level=%s x-rate-limit=%s/%s reset=%s txid=%s rtime=%s | body=%s",
-			endpoint, resp.StatusCode, v2.Title, v2.Detail, v2.Type, access, rateR, rateL, rateT, txid, xtime, string(body))
+	mediaType, category, err := sniffMedia(f)
+	if err != nil {
+		return "", err
 	}
-	// Try v1.1-style error array.
-	var v1 xErrorV1
-	if json.Unmarshal(body, &v1) == nil && len(v1.Errors) > 0 {
-		var parts []string
-		for _, e := range v1.Errors {
-			parts = append(parts, fmt.Sprintf("code=%d msg=%q", e.Code, e.Message))
-		}
-		return fmt.Sprintf("%s %d: %s | x-access-level=%s x-rate-limit=%s/%s reset=%s txid=%s rtime=%s | body=%s",
-			endpoint, resp.StatusCode, strings.Join(parts, "; "), access, rateR, rateL, rateT, txid, xtime, string(body))
+
+	r, err := postMediaUpload(ctx, httpClient, []string{
+		"media_category", category,
+		"media_type", mediaType,
+	}, filepath.Base(imagePath), f)
+	if err != nil {
+		return "", err
 	}
-	// Fallback.
-	return fmt.Sprintf("%s %d: x-access-level=%s x-rate-limit=%s/%s reset=%s txid=%s rtime=%s | body=%s",
-		endpoint, resp.StatusCode, access, rateR, rateL, rateT, txid, xtime, string(body))
+	return mediaIDOf(r)
 }
 
-// ===================== X (Twitter) =====================
+// uploadMediaChunked sends a file through the INIT/APPEND/FINALIZE chunked
+// upload, uploadChunkSize bytes per APPEND.
+func uploadMediaChunked(ctx context.Context, httpClient *http.Client, imagePath string) (string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-// OAuth1 user-context HTTP client
-func newOAuth1HTTPClient(consumerKey, consumerSecret, accessToken, accessSecret string) *http.Client {
-	cfg := oauth1.NewConfig(consumerKey, consumerSecret)
-	tok := oauth1.NewToken(accessToken, accessSecret)
-	return cfg.Client(context.Background(), tok)
-}
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	mediaType, category, err := sniffMedia(f)
+	if err != nil {
+		return "", err
+	}
 
-// Uploads multiple images (simple upload, ≤5MB each). Returns media_id strings.
-func uploadImages(httpClient *http.Client, paths []string) ([]string, error) {
-	if len(paths) == 0 {
-		return nil, nil
+	r, err := postMediaUpload(ctx, httpClient, []string{
+		"command", "INIT",
+		"total_bytes", strconv.FormatInt(fi.Size(), 10),
+		"media_type", mediaType,
+		"media_category", category,
+	}, "", nil)
+	if err != nil {
+		return "", err
 	}
-	if len(paths) > 4 {
-		paths = paths[:4]
+	id, err := mediaIDOf(r)
+	if err != nil {
+		return "", err
 	}
-	ids := make([]string, 0, len(paths))
-	for _, p := range paths {
-		id, err := uploadMediaSimple(httpClient, p)
+
+	chunk := make([]byte, uploadChunkSize)
+	for seg := 0; ; seg++ {
+		n, err := io.ReadFull(f, chunk)
+		if n > 0 {
+			if _, aerr := postMediaUpload(ctx, httpClient, []string{
+				"command", "APPEND",
+				"media_id", id,
+				"segment_index", strconv.Itoa(seg),
+			}, filepath.Base(imagePath), bytes.NewReader(chunk[:n])); aerr != nil {
+				return "", aerr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
 		if err != nil {
-			return nil, fmt.Errorf("upload %s: %w", p, err)
+			return "", err
 		}
-		ids = append(ids, id)
 	}
-	return ids, nil
-}
 
-func uploadMediaSimple(httpClient *http.Client, imagePath string) (string, error) {
-	// Endpoint: https://upload.twitter.com/1.1/media/upload.json
-	f, err := os.Open(imagePath)
-	if err != nil {
+	if _, err := postMediaUpload(ctx, httpClient, []string{
+		"command", "FINALIZE",
+		"media_id", id,
+	}, "", nil); err != nil {
 		return "", err
 	}
-	defer f.Close()
+	return id, nil
+}
 
+// postMediaUpload sends one multipart request to media/upload with the given
+// name/value field pairs and, if media is non-nil, a "media" file part.
+// An empty response body (as from APPEND) decodes to the zero value.
+func postMediaUpload(ctx context.Context, httpClient *http.Client, fields []string, name string, media io.Reader) (model.MediaUploadResp, error) {
+	var r model.MediaUploadResp
 	var buf bytes.Buffer
 	w := multipart.NewWriter(&buf)
 
-	// field name must be "media"
-	part, err := w.CreateFormFile("media", filepath.Base(imagePath))
-	if err != nil {
-		return "", err
+	for i := 0; i+1 < len(fields); i += 2 {
+		if err := w.WriteField(fields[i], fields[i+1]); err != nil {
+			return r, err
+		}
 	}
-	if _, err := io.Copy(part, f); err != nil {
-		return "", err
+	if media != nil {
+		// field name must be "media"
+		part, err := w.CreateFormFile("media", name)
+		if err != nil {
+			return r, err
+		}
+		if _, err := io.Copy(part, media); err != nil {
+			return r, err
+		}
 	}
 	if err := w.Close(); err != nil {
-		return "", err
+		return r, err
 	}
 
-	req, err := http.NewRequest("POST", "https://upload.twitter.com/1.1/media/upload.json", &buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://upload.twitter.com/1.1/media/upload.json", &buf)
 	if err != nil {
-		return "", err
+		return r, err
 	}
 	req.Header.Set("Content-Type", w.FormDataContentType())
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return r, err
 	}
 	defer resp.Body.Close()
 
+	b, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		msg := diagnoseHTTPError(resp, b, "POST /1.1/media/upload.json")
-		return "", fmt.Errorf(msg)
+		return r, httpError(resp, b, "POST /1.1/media/upload.json")
 	}
-
-	var r model.MediaUploadResp
-	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		return "", err
+	if len(bytes.TrimSpace(b)) == 0 {
+		return r, nil
 	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func mediaIDOf(r model.MediaUploadResp) (string, error) {
 	if r.MediaIDString != "" {
 		return r.MediaIDString, nil
 	}
@@ -364,11 +2006,73 @@ func uploadMediaSimple(httpClient *http.Client, imagePath string) (string, error
 	return "", fmt.Errorf("media upload: missing media_id")
 }
 
-func createTweetV2(httpClient *http.Client, text string, mediaIDs []string) (string, error) {
-	reqBody := model.TweetReq{Text: text}
+// supportedMediaTypes are the image formats X accepts for tweet media.
+var supportedMediaTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// sniffMedia detects the content type of an image from its leading bytes and
+// maps it to the X media_category ("tweet_image" or, for animated GIFs,
+// "tweet_gif"). The file offset is rewound before returning.
+func sniffMedia(f io.ReadSeeker) (mediaType, category string, err error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", "", err
+	}
+	head = head[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+
+	mediaType = http.DetectContentType(head)
+	if isAVIF(head) {
+		mediaType = "image/avif"
+	}
+	switch mediaType {
+	case "image/jpeg", "image/png", "image/webp":
+		return mediaType, "tweet_image", nil
+	case "image/gif":
+		g, err := gif.DecodeAll(f)
+		if _, serr := f.Seek(0, io.SeekStart); serr != nil {
+			return "", "", serr
+		}
+		if err == nil && len(g.Image) > 1 {
+			return mediaType, "tweet_gif", nil
+		}
+		return mediaType, "tweet_image", nil
+	}
+	return "", "", fmt.Errorf("unsupported media type %s (supported: %s)",
+		mediaType, strings.Join(supportedMediaTypes, ", "))
+}
+
+// isAVIF reports whether head starts with an ISO-BMFF "ftyp" box carrying an
+// AVIF brand; http.DetectContentType does not recognise AVIF.
+func isAVIF(head []byte) bool {
+	if len(head) < 12 || string(head[4:8]) != "ftyp" {
+		return false
+	}
+	brand := string(head[8:12])
+	return brand == "avif" || brand == "avis"
+}
+
+// tweetOptions carries the optional fields of a v2 create-tweet request; the
+// zero value sends a plain tweet.
+type tweetOptions struct {
+	InReplyTo    string           // id of the tweet this one replies to
+	QuoteTweetID string           // id of the tweet this one quotes
+	Poll         *model.TweetPoll // not allowed together with media
+}
+
+func createTweetV2(httpClient *http.Client, text string, mediaIDs []string, opts tweetOptions) (string, error) {
+	if opts.Poll != nil && len(mediaIDs) > 0 {
+		return "", errPollWithMedia
+	}
+	reqBody := model.TweetReq{Text: text, QuoteTweetID: opts.QuoteTweetID, Poll: opts.Poll}
 	if len(mediaIDs) > 0 {
 		reqBody.Media = &model.TweetMedia{MediaIDs: mediaIDs}
 	}
+	if opts.InReplyTo != "" {
+		reqBody.Reply = &model.TweetReply{InReplyToTweetID: opts.InReplyTo}
+	}
 
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(&reqBody); err != nil {
@@ -389,8 +2093,7 @@ func createTweetV2(httpClient *http.Client, text string, mediaIDs []string) (str
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(resp.Body)
-		msg := diagnoseHTTPError(resp, b, "POST /2/tweets")
-		return "", fmt.Errorf(msg)
+		return "", httpError(resp, b, "POST /2/tweets")
 	}
 
 	var r model.TweetResp
@@ -403,8 +2106,55 @@ func createTweetV2(httpClient *http.Client, text string, mediaIDs []string) (str
 	return r.Data.ID, nil
 }
 
+// errTweetGone reports that a tweet to delete no longer exists.
+var errTweetGone = errors.New("tweet already deleted")
+
+// deleteTweetV2 deletes a tweet, returning errTweetGone if X has no such
+// tweet (any more).
+func deleteTweetV2(httpClient *http.Client, id string) error {
+	req, err := http.NewRequest("DELETE", "https://api.twitter.com/2/tweets/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errTweetGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return httpError(resp, b, "DELETE /2/tweets/:id")
+	}
+	var r struct {
+		Data struct {
+			Deleted bool `json:"deleted"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if !r.Data.Deleted {
+		return errTweetGone
+	}
+	return nil
+}
+
 // ===================== misc =====================
 
+const defaultVerseURLTemplate = "https://twitter.com/i/web/status/{id}"
+
+// verseURLTemplate is set by -verse-url-template.
+var verseURLTemplate = defaultVerseURLTemplate
+
+// verseURL links to the post with the given id.
+func verseURL(id string) string {
+	return strings.ReplaceAll(verseURLTemplate, "{id}", url.PathEscape(id))
+}
+
 func envOr(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
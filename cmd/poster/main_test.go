@@ -1,18 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
-
-	_ "modernc.org/sqlite"
+	"time"
 
 	"github.com/mikequentel/dhammapada/internal/model"
 )
@@ -111,6 +119,21 @@ func TestEnvOr(t *testing.T) {
 	}
 }
 
+// ===================== verseURL =====================
+
+func TestVerseURL(t *testing.T) {
+	defer func(orig string) { verseURLTemplate = orig }(verseURLTemplate)
+
+	if got := verseURL("123"); got != "https://twitter.com/i/web/status/123" {
+		t.Errorf("default verseURL = %q", got)
+	}
+
+	verseURLTemplate = "https://x.com/portablebuddha/status/{id}?ref={id}"
+	if got := verseURL("456"); got != "https://x.com/portablebuddha/status/456?ref=456" {
+		t.Errorf("custom verseURL = %q", got)
+	}
+}
+
 // ===================== formatStatus =====================
 
 func TestFormatStatus_Short(t *testing.T) {
@@ -160,6 +183,384 @@ func TestFormatStatus_ExactlyMaxLen(t *testing.T) {
 	}
 }
 
+func TestRenderStatus_BilingualFits(t *testing.T) {
+	txt := &model.Text{Label: "183", Body: "Not to commit any sin.", Pali: "Sabbapāpassa akaraṇaṃ."}
+
+	status, truncated := renderStatus(txt, statusOptions{Bilingual: true})
+	if truncated {
+		t.Error("did not expect truncation")
+	}
+	if !strings.HasPrefix(status, "183: Not to commit any sin.\nPāli: Sabbapāpassa akaraṇaṃ. — Dhammapada") {
+		t.Errorf("unexpected bilingual status: %q", status)
+	}
+
+	// Without -bilingual the Pāli is ignored.
+	if plain, _ := renderStatus(txt, statusOptions{}); strings.Contains(plain, "Pāli") {
+		t.Errorf("did not expect Pāli without bilingual mode: %q", plain)
+	}
+}
+
+func TestRenderStatus_BilingualTruncatesEnglishFirst(t *testing.T) {
+	pali := "Sabbapāpassa akaraṇaṃ, kusalassa upasampadā."
+	txt := &model.Text{Label: "183", Body: strings.Repeat("word ", 100), Pali: pali}
+
+	status, truncated := renderStatus(txt, statusOptions{Bilingual: true})
+	if !truncated {
+		t.Error("expected truncation")
+	}
+	if runeLen(status) > 280 {
+		t.Errorf("status exceeds 280 runes: %d", runeLen(status))
+	}
+	if !strings.Contains(status, "…"+paliSep+pali+" — Dhammapada") {
+		t.Errorf("expected the English truncated and the Pāli intact: %q", status)
+	}
+}
+
+func TestRenderStatus_BilingualLongPali(t *testing.T) {
+	txt := &model.Text{Label: "1", Body: strings.Repeat("word ", 100), Pali: strings.Repeat("pāli ", 100)}
+
+	status, _ := renderStatus(txt, statusOptions{Bilingual: true})
+	if runeLen(status) > 280 {
+		t.Errorf("status exceeds 280 runes: %d", runeLen(status))
+	}
+	if !strings.HasPrefix(status, "1: word word word word …"+paliSep+"pāli") {
+		t.Errorf("expected a minimal translation then trimmed Pāli: %q", status)
+	}
+}
+
+func TestRenderStatus_MaxLen(t *testing.T) {
+	txt := &model.Text{Label: "1", Body: strings.Repeat("word ", 100)}
+
+	if _, truncated := renderStatus(txt, statusOptions{}); !truncated {
+		t.Error("expected truncation at the default 280")
+	}
+	status, truncated := renderStatus(txt, statusOptions{MaxLen: discordMaxLen})
+	if truncated || !strings.Contains(status, strings.TrimSpace(txt.Body)) {
+		t.Errorf("expected the full body within %d: %q", discordMaxLen, status)
+	}
+
+	// -max-len 1000, as for an X premium account.
+	txt.Body = strings.Repeat("abcd ", 100) // 500 runes
+	status, truncated = renderStatus(txt, statusOptions{MaxLen: 1000})
+	if truncated || !strings.Contains(status, strings.TrimSpace(txt.Body)) {
+		t.Errorf("expected a 500-rune body untruncated within 1000: %q", status)
+	}
+}
+
+func TestRenderStatus_MaxBodyChars(t *testing.T) {
+	body := strings.Repeat("abcdefghi ", 20) // 200 runes
+	txt := &model.Text{Label: "5", Body: body}
+
+	status, truncated := renderStatus(txt, statusOptions{MaxBodyChars: 100})
+	if !truncated {
+		t.Error("expected the body cap to count as truncation")
+	}
+	want := "5: " + strings.TrimSpace(strings.Repeat("abcdefghi ", 10)) + "… — Dhammapada (F Max Müller) " + defaultHashtags
+	if status != want {
+		t.Errorf("got  %q\nwant %q", status, want)
+	}
+
+	// Mid-word cuts back to the previous space.
+	status, _ = renderStatus(txt, statusOptions{MaxBodyChars: 15})
+	if !strings.HasPrefix(status, "5: abcdefghi… — ") {
+		t.Errorf("expected a cut at the word boundary: %q", status)
+	}
+
+	// A cap above the body length changes nothing.
+	if status, truncated := renderStatus(&model.Text{Label: "5", Body: "Short."}, statusOptions{MaxBodyChars: 100}); truncated || !strings.HasPrefix(status, "5: Short. — ") {
+		t.Errorf("unexpected status for a short body: %q", status)
+	}
+}
+
+func TestRenderStatus_LabelPrefix(t *testing.T) {
+	txt := &model.Text{Label: "183", Body: strings.Repeat("word ", 100)}
+
+	// Empty prefix keeps the plain "183: " header.
+	plain, _ := renderStatus(txt, statusOptions{})
+	if got, _ := renderStatus(txt, statusOptions{LabelPrefix: ""}); got != plain || !strings.HasPrefix(got, "183: word") {
+		t.Errorf("unexpected status with empty prefix: %q", got)
+	}
+
+	// A multibyte prefix is counted in runes, not bytes.
+	status, truncated := renderStatus(txt, statusOptions{LabelPrefix: "Gāthā"})
+	if !truncated || !strings.HasPrefix(status, "Gāthā 183: word") {
+		t.Errorf("unexpected status with prefix: %q", status)
+	}
+	if runeLen(status) > 280 || runeLen(status) < 275 {
+		t.Errorf("expected the status to fill the 280-rune budget, got %d", runeLen(status))
+	}
+}
+
+func TestRenderStatus_ASCIIEllipsisAndSeparator(t *testing.T) {
+	txt := &model.Text{Label: "1", Body: strings.Repeat("word ", 100)}
+
+	status, truncated := renderStatus(txt, statusOptions{Ellipsis: "...", AttributionSep: "-"})
+	if !truncated {
+		t.Error("expected truncation")
+	}
+	if runeLen(status) != 280 {
+		t.Errorf("expected the status to fill exactly 280 runes, got %d", runeLen(status))
+	}
+	if !strings.Contains(status, "... - Dhammapada (F Max Müller) #dhammapada") || strings.Contains(status, "…") {
+		t.Errorf("expected the ASCII ellipsis and separator: %q", status)
+	}
+}
+
+func TestChapterHashtag(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Twin Verses", "#TwinVerses"},
+		{"The Wise Man (Paṇḍita)", "#TheWiseManPaṇḍita"},
+		{"buddha", "#Buddha"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := chapterHashtag(tt.in); got != tt.want {
+			t.Errorf("chapterHashtag(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderStatus_TextInAlt(t *testing.T) {
+	txt := &model.Text{Label: "3", Body: "He abused me, he beat me.", Images: []string{"3.jpg"}}
+	o := statusOptions{TextInAlt: true}
+
+	if status, _ := renderStatus(txt, o); status != "3 — Dhammapada (F Max Müller) "+defaultHashtags {
+		t.Errorf("expected label and attribution only: %q", status)
+	}
+	if alt := altText(txt, o); alt != txt.Body {
+		t.Errorf("alt text = %q, want the body", alt)
+	}
+
+	// Without an image to carry it, the body stays in the status.
+	txt.Images = nil
+	if status, _ := renderStatus(txt, o); !strings.Contains(status, txt.Body) || altText(txt, o) != "" {
+		t.Errorf("expected the full status for a text-only verse: %q", status)
+	}
+}
+
+func TestRenderStatus_NoHashtagsNoAttribution(t *testing.T) {
+	txt := &model.Text{Label: "1", Body: strings.Repeat("word ", 100), Chapter: "Twin Verses"}
+	full, _ := renderStatus(txt, statusOptions{})
+
+	tests := []struct {
+		name          string
+		o             statusOptions
+		gone, kept    []string
+		budgetGrowsBy int
+	}{
+		{"no hashtags", statusOptions{NoHashtags: true, ChapterHashtag: true},
+			[]string{"#"}, []string{"… — Dhammapada (F Max Müller)"}, runeLen(" " + defaultHashtags)},
+		{"no attribution", statusOptions{NoAttribution: true},
+			[]string{"Dhammapada (F Max Müller)", "—"}, []string{"… " + defaultHashtags}, runeLen(" — Dhammapada (F Max Müller)")},
+		{"neither", statusOptions{NoHashtags: true, NoAttribution: true},
+			[]string{"#", "Dhammapada (F Max Müller)"}, nil, runeLen(" — Dhammapada (F Max Müller) " + defaultHashtags)},
+	}
+	for _, tt := range tests {
+		status, truncated := renderStatus(txt, tt.o)
+		for _, s := range tt.gone {
+			if strings.Contains(status, s) {
+				t.Errorf("%s: status still has %q: %q", tt.name, s, status)
+			}
+		}
+		for _, s := range tt.kept {
+			if !strings.Contains(status, s) {
+				t.Errorf("%s: status lacks %q: %q", tt.name, s, status)
+			}
+		}
+		if !truncated || runeLen(status) > xMaxLen {
+			t.Errorf("%s: want a truncated status within %d runes, got %d", tt.name, xMaxLen, runeLen(status))
+		}
+		// The freed room goes to the body.
+		grown := strings.Count(status, "word") - strings.Count(full, "word")
+		if want := tt.budgetGrowsBy / len("word "); grown < want-1 || grown > want+1 {
+			t.Errorf("%s: body grew by %d words, want about %d", tt.name, grown, want)
+		}
+	}
+}
+
+func TestRenderStatus_Pretty(t *testing.T) {
+	short := &model.Text{Label: "1", Body: "Mind precedes all mental states."}
+	status, truncated := renderStatus(short, statusOptions{Pretty: true, LabelPrefix: "Dhp"})
+	want := "Dhp 1\nMind precedes all mental states.\nDhammapada (F Max Müller)\n" + defaultHashtags
+	if status != want || truncated {
+		t.Errorf("got %q (truncated=%v), want %q", status, truncated, want)
+	}
+
+	long := &model.Text{Label: "1", Body: strings.Repeat("word ", 100)}
+	for _, maxLen := range []int{xMaxLen, 120} {
+		status, truncated := renderStatus(long, statusOptions{Pretty: true, MaxLen: maxLen})
+		lines := strings.Split(status, "\n")
+		if len(lines) != 4 || lines[0] != "1" || !strings.HasSuffix(lines[1], "…") || lines[3] != defaultHashtags {
+			t.Errorf("max-len %d: unexpected lines %q", maxLen, lines)
+		}
+		if !truncated || runeLen(status) > maxLen {
+			t.Errorf("max-len %d: want a truncated status within budget, got %d runes", maxLen, runeLen(status))
+		}
+	}
+}
+
+func TestStripNextVerseNumber(t *testing.T) {
+	tests := []struct {
+		label, body, want string
+	}{
+		{"10", "All men tremble at punishment. 11", "All men tremble at punishment."},
+		{"10", "All men tremble at punishment.\n11", "All men tremble at punishment."},
+		{"58–59", "Shines forth by wisdom. 60", "Shines forth by wisdom."},
+		{"10", "All men tremble at punishment. 12", "All men tremble at punishment. 12"}, // not the next verse
+		{"10", "Verse11", "Verse11"},                   // not standalone
+		{"10", "Eleven 11 times.", "Eleven 11 times."}, // not at the end
+		{"I", "No number. 2", "No number. 2"},          // label without a number
+	}
+	for _, tt := range tests {
+		if got := stripNextVerseNumber(tt.body, tt.label); got != tt.want {
+			t.Errorf("stripNextVerseNumber(%q, %q) = %q, want %q", tt.body, tt.label, got, tt.want)
+		}
+	}
+
+	txt := &model.Text{Label: "10", Body: "All men tremble at punishment. 11"}
+	if status, _ := renderStatus(txt, statusOptions{StripVerseNum: true}); strings.Contains(status, "11") {
+		t.Errorf("expected the stray 11 stripped: %q", status)
+	}
+	if status, _ := renderStatus(txt, statusOptions{}); !strings.Contains(status, "punishment. 11") {
+		t.Errorf("expected the body untouched by default: %q", status)
+	}
+}
+
+func TestRenderStatus_ChapterHashtag(t *testing.T) {
+	txt := &model.Text{Label: "1", Body: strings.Repeat("word ", 100), Chapter: "Twin Verses"}
+
+	status, _ := renderStatus(txt, statusOptions{ChapterHashtag: true})
+	if !strings.HasSuffix(status, defaultHashtags+" #TwinVerses") {
+		t.Errorf("expected the chapter hashtag after the defaults: %q", status)
+	}
+	if runeLen(status) > 280 {
+		t.Errorf("status exceeds 280 runes: %d", runeLen(status))
+	}
+
+	// A chapter matching a default hashtag is not repeated.
+	txt.Chapter = "Buddha"
+	if status, _ := renderStatus(txt, statusOptions{ChapterHashtag: true}); !strings.HasSuffix(status, " "+defaultHashtags) {
+		t.Errorf("expected no duplicate hashtag: %q", status)
+	}
+
+	// Off by default.
+	txt.Chapter = "Twin Verses"
+	if status, _ := renderStatus(txt, statusOptions{}); strings.Contains(status, "#TwinVerses") {
+		t.Errorf("did not expect a chapter hashtag by default: %q", status)
+	}
+}
+
+// ===================== dry run =====================
+
+func TestWriteDryRunPreview_Truncated(t *testing.T) {
+	txt := &model.Text{ID: 1, Label: "42", Body: strings.Repeat("word ", 100), Images: []string{"images/42.jpg"}}
+	out := filepath.Join(t.TempDir(), "preview.json")
+
+	if err := writeDryRunPreview(out, newDryRunPreview(txt, statusOptions{})); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got dryRunPreview
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("invalid preview JSON: %v\n%s", err, b)
+	}
+	if got.Status != formatStatus(txt.Label, txt.Body) {
+		t.Errorf("status = %q, want formatStatus output", got.Status)
+	}
+	if got.Length != runeLen(got.Status) || got.Length > 280 {
+		t.Errorf("length = %d, want %d (≤ 280)", got.Length, runeLen(got.Status))
+	}
+	if !got.WouldTruncate {
+		t.Error("expected would_truncate for a long verse")
+	}
+	if len(got.Images) != 1 || got.Images[0] != "images/42.jpg" {
+		t.Errorf("images = %v, want [images/42.jpg]", got.Images)
+	}
+}
+
+func TestNewDryRunPreview_NoImages(t *testing.T) {
+	p := newDryRunPreview(&model.Text{Label: "1", Body: "Short verse."}, statusOptions{})
+	if p.WouldTruncate {
+		t.Error("did not expect would_truncate for a short verse")
+	}
+	if p.Images == nil {
+		t.Error("expected an empty (non-nil) image list so JSON renders []")
+	}
+}
+
+// ===================== printStatus =====================
+
+func TestPrintStatus(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (1, '1', 'First verse.')`)
+	db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (2, '2', 'Second verse.')`)
+
+	var out bytes.Buffer
+	if err := printStatus(context.Background(), &out, &runner{db: db, sel: selector{label: "2"}, imagesDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if want := formatStatus("2", "Second verse.") + "\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := printStatus(context.Background(), &out, &runner{db: db, sel: selector{order: orderSeq}, imagesDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if want := formatStatus("1", "First verse.") + "\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	var posted sql.NullString
+	db.QueryRow(`SELECT posted_at FROM texts WHERE id = 1`).Scan(&posted)
+	if posted.Valid {
+		t.Error("print-status must not mark the verse posted")
+	}
+}
+
+func TestPrintStatus_MatchesPost(t *testing.T) {
+	r := seedTexts(t, 1)
+	body := strings.Repeat("word ", 300)
+	r.db.Exec(`UPDATE texts SET text_body = ? WHERE id = 1`, body)
+	var out bytes.Buffer
+	render := func(cfg *config) string {
+		t.Helper()
+		cfg.imagesDir = r.imagesDir
+		if err := setupPlatform(cfg); err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		if err := printStatus(context.Background(), &out, previewRunner(cfg, r.db)); err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSuffix(out.String(), "\n")
+	}
+
+	// Telegram's caption budget, not X's.
+	if n := runeLen(render(&config{platform: platformTelegram})); n <= xMaxLen || n > telegramMaxLen {
+		t.Errorf("telegram status is %d runes", n)
+	}
+
+	// With -text-in-alt the body goes to the image, as it would when posted.
+	os.WriteFile(filepath.Join(r.imagesDir, "1.jpg"), fakeJPEG, 0644)
+	cfg := &config{platform: platformX}
+	cfg.status.TextInAlt = true
+	if got := render(cfg); strings.Contains(got, "word") {
+		t.Errorf("-text-in-alt status still has the body: %q", got)
+	}
+
+	cfg = &config{platform: platformX}
+	cfg.status.MaxLen = xPremiumMaxLen + 1
+	if err := setupPlatform(cfg); err == nil {
+		t.Error("an over-long -max-len was accepted")
+	}
+}
+
 // ===================== existsFile =====================
 
 func TestExistsFile(t *testing.T) {
@@ -237,7 +638,7 @@ func TestDeriveImagePaths(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.label, func(t *testing.T) {
-			paths, err := deriveImagePaths(tt.label)
+			paths, err := deriveImagePaths("images", tt.label)
 			if err != nil {
 				t.Fatalf("deriveImagePaths(%q) error: %v", tt.label, err)
 			}
@@ -262,16 +663,196 @@ func TestDeriveImagePaths_MultipleImages(t *testing.T) {
 		os.WriteFile(filepath.Join(imgDir, name), []byte("fake"), 0644)
 	}
 
-	paths, err := deriveImagePaths("7")
+	paths, err := deriveImagePaths("images", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every variant is returned; posters apply their own caps.
+	if len(paths) != 5 {
+		t.Errorf("expected 5 images (7.jpg + 7-1..7-4), got %d: %v", len(paths), paths)
+	}
+}
+
+func TestDeriveImagePaths_NumericSuffixOrder(t *testing.T) {
+	imgDir := t.TempDir()
+
+	// Lexically "-10" sorts before "-2"; numerically it must come after.
+	for _, name := range []string{"9-10.jpg", "9-2.jpg", "9.jpg", "9-1.jpg", "9-11.jpg"} {
+		os.WriteFile(filepath.Join(imgDir, name), []byte("fake"), 0644)
+	}
+
+	paths, err := deriveImagePaths(imgDir, "9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(imgDir, "9.jpg"),
+		filepath.Join(imgDir, "9-1.jpg"),
+		filepath.Join(imgDir, "9-2.jpg"),
+		filepath.Join(imgDir, "9-10.jpg"),
+		filepath.Join(imgDir, "9-11.jpg"),
+	}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("deriveImagePaths(9) = %v, want %v", paths, want)
+	}
+}
+
+func TestDeriveImagePaths_IgnoresOtherLabels(t *testing.T) {
+	imgDir := t.TempDir()
+
+	for _, name := range []string{"1.jpg", "10.jpg", "1-x.jpg", "1-01.jpg", "1.txt"} {
+		os.WriteFile(filepath.Join(imgDir, name), []byte("fake"), 0644)
+	}
+
+	paths, err := deriveImagePaths(imgDir, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != filepath.Join(imgDir, "1.jpg") {
+		t.Errorf("deriveImagePaths(1) = %v, want [%s]", paths, filepath.Join(imgDir, "1.jpg"))
+	}
+}
+
+func TestDeriveImagePaths_EnDashFilename(t *testing.T) {
+	imgDir := t.TempDir()
+	for _, name := range []string{"58–59.jpg", "58–59-2.jpg"} {
+		os.WriteFile(filepath.Join(imgDir, name), []byte("fake"), 0644)
+	}
+
+	// Stored with a hyphen or an en dash, the label finds the en-dash files.
+	for _, label := range []string{"58-59", "58–59"} {
+		paths, err := deriveImagePaths(imgDir, label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{filepath.Join(imgDir, "58–59.jpg"), filepath.Join(imgDir, "58–59-2.jpg")}
+		if strings.Join(paths, ",") != strings.Join(want, ",") {
+			t.Errorf("deriveImagePaths(%s) = %v, want %v", label, paths, want)
+		}
+	}
+}
+
+func TestDeriveImagePaths_Extensions(t *testing.T) {
+	imgDir := t.TempDir()
+	for _, name := range []string{
+		"42.png", "42.jpg", // same base: jpg preferred
+		"42-1.GIF",               // upper-case extension
+		"42-2.webp", "42-2.jpeg", // jpeg preferred over webp
+		"42-3.bmp",          // unsupported
+		"43.JPEG", "43.Png", // different label
+	} {
+		os.WriteFile(filepath.Join(imgDir, name), []byte("fake"), 0644)
+	}
+
+	tests := []struct {
+		label string
+		want  []string
+	}{
+		{"42", []string{"42.jpg", "42-1.GIF", "42-2.jpeg"}},
+		{"43", []string{"43.JPEG"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			paths, err := deriveImagePaths(imgDir, tt.label)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range paths {
+				got = append(got, filepath.Base(p))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("deriveImagePaths(%s) = %v, want %v", tt.label, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveImagePaths_ExplicitDir(t *testing.T) {
+	// No os.Chdir: the directory is passed in, so the working directory is
+	// irrelevant.
+	imgDir := filepath.Join(t.TempDir(), "calligraphy")
+	os.Mkdir(imgDir, 0755)
+	os.WriteFile(filepath.Join(imgDir, "5.jpg"), []byte("fake"), 0644)
+
+	paths, err := deriveImagePaths(imgDir, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != filepath.Join(imgDir, "5.jpg") {
+		t.Errorf("deriveImagePaths(%s, 5) = %v", imgDir, paths)
+	}
+
+	// A missing directory just means no images.
+	paths, err = deriveImagePaths(filepath.Join(t.TempDir(), "missing"), "5")
+	if err != nil || len(paths) != 0 {
+		t.Errorf("deriveImagePaths(missing dir) = %v, %v; want no paths, nil", paths, err)
+	}
+}
+
+// ===================== usableImages =====================
+
+func TestUsableImages(t *testing.T) {
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "1.jpg")
+	os.WriteFile(ok, fakeJPEG, 0644)
+	missing := filepath.Join(dir, "1-1.jpg")
+
+	got, err := usableImages([]string{ok, missing}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != ok {
+		t.Errorf("usableImages = %v, want [%s]", got, ok)
+	}
+
+	if _, err := usableImages([]string{ok, missing}, true); err == nil {
+		t.Error("expected error for missing image when images are required")
+	}
+}
+
+func TestUsableImages_PostsWithRemainingImage(t *testing.T) {
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "1.jpg")
+	os.WriteFile(ok, fakeJPEG, 0644)
+	missing := filepath.Join(dir, "1-1.jpg")
+
+	uploads := 0
+	var tweet model.TweetReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.1/media/upload.json":
+			uploads++
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "m1"})
+		case "/2/tweets":
+			json.NewDecoder(r.Body).Decode(&tweet)
+			w.Write([]byte(`{"data":{"id":"123"}}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+	}
+
+	images, err := usableImages([]string{ok, missing}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaIDs, err := uploadImages(client, images, uploadOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	// Should return at most 4.
-	if len(paths) > 4 {
-		t.Errorf("expected at most 4 images, got %d", len(paths))
+	if _, err := createTweetV2(client, "verse", mediaIDs, tweetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if uploads != 1 {
+		t.Errorf("expected 1 upload, got %d", uploads)
 	}
-	if len(paths) < 4 {
-		t.Errorf("expected 4 images (7.jpg + 7-1..7-3), got %d: %v", len(paths), paths)
+	if tweet.Media == nil || len(tweet.Media.MediaIDs) != 1 || tweet.Media.MediaIDs[0] != "m1" {
+		t.Errorf("expected tweet with media [m1], got %+v", tweet.Media)
 	}
 }
 
@@ -324,14 +905,49 @@ func TestDiagnoseHTTPError_Fallback(t *testing.T) {
 	}
 }
 
-// ===================== getRandomUnpostedTextAndImages =====================
-
-func newTestDB(t *testing.T) *sql.DB {
-	t.Helper()
-	db, err := sql.Open("sqlite", ":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
+func TestDiagnoseHTTPError_RateLimited(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 429,
+		Header: http.Header{
+			"X-Rate-Limit-Limit":     {"17"},
+			"X-Rate-Limit-Remaining": {"0"},
+			"X-Rate-Limit-Reset":     {"1767225600"}, // 2026-01-01 00:00:00 UTC
+		},
+	}
+	msg := diagnoseHTTPError(resp, []byte(`{"title":"Too Many Requests","detail":"Too Many Requests"}`), "POST /2/tweets")
+	if !strings.Contains(msg, "Too Many Requests") {
+		t.Errorf("expected v2 title in message, got: %s", msg)
+	}
+	if !strings.Contains(msg, "limit=17 remaining=0") {
+		t.Errorf("expected rate-limit counters in message, got: %s", msg)
+	}
+	if !strings.Contains(msg, "retry after 2026-01-01 00:00:00 UTC") {
+		t.Errorf("expected human-readable reset time in message, got: %s", msg)
+	}
+}
+
+func TestDiagnoseHTTPError_NotRateLimited(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 500,
+		Header:     http.Header{"X-Rate-Limit-Reset": {"1767225600"}},
+	}
+	msg := diagnoseHTTPError(resp, []byte("oops"), "GET /endpoint")
+	if strings.Contains(msg, "retry after") {
+		t.Errorf("did not expect a retry hint for a non-429 response, got: %s", msg)
+	}
+}
+
+// ===================== getRandomUnpostedTextAndImages =====================
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	sqldb, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{DB: sqldb, driver: driverSQLite}
+	// Each connection to ":memory:" is a separate database; keep just one.
+	db.SetMaxOpenConns(1)
 	_, err = db.Exec(`CREATE TABLE texts (
 		id        INTEGER PRIMARY KEY,
 		label     TEXT NOT NULL UNIQUE,
@@ -342,6 +958,10 @@ func newTestDB(t *testing.T) *sql.DB {
 	if err != nil {
 		t.Fatal(err)
 	}
+	// Start from the original schema and migrate, as openDBForWrite does.
+	if err := db.migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
 	return db
 }
 
@@ -349,7 +969,7 @@ func TestGetRandomUnpostedTextAndImages_NoRows(t *testing.T) {
 	db := newTestDB(t)
 	defer db.Close()
 
-	_, err := getRandomUnpostedTextAndImages(context.Background(), db)
+	_, err := getRandomUnpostedTextAndImages(context.Background(), db, "images")
 	if err == nil {
 		t.Fatal("expected error for empty table, got nil")
 	}
@@ -365,7 +985,7 @@ func TestGetRandomUnpostedTextAndImages_AllPosted(t *testing.T) {
 	db.Exec(`INSERT INTO texts (id, label, text_body, posted_at, x_post_id)
 		VALUES (1, '1', 'verse one', '2025-01-01', '12345')`)
 
-	_, err := getRandomUnpostedTextAndImages(context.Background(), db)
+	_, err := getRandomUnpostedTextAndImages(context.Background(), db, "images")
 	if err == nil {
 		t.Fatal("expected error when all texts are posted, got nil")
 	}
@@ -375,15 +995,11 @@ func TestGetRandomUnpostedTextAndImages_ReturnsUnposted(t *testing.T) {
 	db := newTestDB(t)
 	defer db.Close()
 
-	// Change to a temp dir so deriveImagePaths won't find anything in images/.
-	origDir, _ := os.Getwd()
-	os.Chdir(t.TempDir())
-	defer os.Chdir(origDir)
-
 	db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (1, '42', 'The wise one')`)
 	db.Exec(`INSERT INTO texts (id, label, text_body, posted_at) VALUES (2, '43', 'Already posted', '2025-01-01')`)
 
-	txt, err := getRandomUnpostedTextAndImages(context.Background(), db)
+	// An empty temp dir so deriveImagePaths won't find anything.
+	txt, err := getRandomUnpostedTextAndImages(context.Background(), db, t.TempDir())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -392,6 +1008,143 @@ func TestGetRandomUnpostedTextAndImages_ReturnsUnposted(t *testing.T) {
 	}
 }
 
+func TestSelectText_Pali(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	db.Exec(`INSERT INTO texts (id, label, text_body, pali) VALUES (1, '183', 'Not to commit any sin.', 'Sabbapāpassa akaraṇaṃ.')`)
+
+	txt, err := selectText(context.Background(), db, selector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt.Pali != "Sabbapāpassa akaraṇaṃ." {
+		t.Errorf("expected Pāli to be selected, got %q", txt.Pali)
+	}
+}
+
+func TestSelectText_TranslatorAttribution(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	db.Exec(`INSERT INTO translators (id, name, attribution) VALUES (2, 'Acharya Buddharakkhita', 'Dhammapada (tr. Buddharakkhita, BPS)')`)
+	db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (1, '1', 'Mind precedes all mental states.')`)
+	db.Exec(`INSERT INTO texts (id, label, text_body, translator_id) VALUES (2, '2', 'Mind precedes all knowables.', 2)`)
+
+	want := map[string]string{
+		"1": "— Dhammapada (F Max Müller) #",
+		"2": "— Dhammapada (tr. Buddharakkhita, BPS) #",
+	}
+	for label, attribution := range want {
+		txt, err := selectText(context.Background(), db, selector{label: label})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, _ := renderStatus(txt, statusOptions{}); !strings.Contains(status, attribution) {
+			t.Errorf("verse %s: status %q lacks %q", label, status, attribution)
+		}
+	}
+}
+
+func TestSelectText_SeqDesc(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	for _, l := range []string{"2", "3", "1"} {
+		db.Exec(`INSERT INTO texts (label, text_body) VALUES (?, 'verse')`, l)
+	}
+
+	txt, err := selectText(context.Background(), db, selector{order: orderSeqDesc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt.Label != "3" {
+		t.Errorf("seq-desc selected %q, want 3", txt.Label)
+	}
+}
+
+func TestSelectText_ExcludeLabels(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (1, '58–59', 'As on a heap of rubbish.')`)
+	db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (2, '60', 'Long is the night.')`)
+	sel := selector{excludeLabels: []string{"58-59"}} // hyphen matches the stored en dash
+
+	for i := 0; i < 10; i++ {
+		txt, err := selectText(context.Background(), db, sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txt.Label != "60" {
+			t.Fatalf("selected excluded label %q", txt.Label)
+		}
+	}
+
+	// With the excluded verse the only one left, selection fails, saying why.
+	db.Exec(`UPDATE texts SET posted_at = CURRENT_TIMESTAMP WHERE id = 2`)
+	for _, s := range []selector{sel, {excludeLabels: sel.excludeLabels, rng: rand.New(rand.NewSource(1))}} {
+		_, err := selectText(context.Background(), db, s)
+		if !errors.Is(err, errNoUnposted) || err.Error() != "no unposted texts remain after exclusions" {
+			t.Errorf("expected errNoUnposted after exclusions, got %v", err)
+		}
+	}
+}
+
+func TestSelectText_SeedIsReproducible(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	for i := 1; i <= 20; i++ {
+		db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (?, ?, ?)`, i, fmt.Sprint(i), "verse")
+	}
+	db.Exec(`UPDATE texts SET posted_at = '2025-01-01' WHERE id = 3`)
+
+	pick := func(seed int64) []string {
+		sel := selector{rng: rand.New(rand.NewSource(seed))}
+		var labels []string
+		for i := 0; i < 3; i++ {
+			txt, err := selectText(context.Background(), db, sel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txt.ID == 3 {
+				t.Error("selected an already-posted verse")
+			}
+			labels = append(labels, txt.Label)
+		}
+		return labels
+	}
+
+	first, second := pick(42), pick(42)
+	if strings.Join(first, ",") != strings.Join(second, ",") {
+		t.Errorf("same seed picked %v then %v", first, second)
+	}
+}
+
+func TestSelectText_Cooldown(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+
+	ago := func(d time.Duration) string { return time.Now().Add(-d).UTC().Format(time.DateTime) }
+	db.Exec(`INSERT INTO texts (id, label, text_body, posted_at) VALUES (1, '1', 'recent', ?)`, ago(48*time.Hour))
+	db.Exec(`INSERT INTO texts (id, label, text_body, posted_at) VALUES (2, '2', 'old', ?)`, ago(10*24*time.Hour))
+
+	sel := selector{cooldown: 7 * 24 * time.Hour}
+	for i := 0; i < 10; i++ {
+		txt, err := selectText(context.Background(), db, sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txt.ID != 2 {
+			t.Fatalf("selected verse %d, posted within the cooldown", txt.ID)
+		}
+	}
+
+	// Without a cooldown both count as posted.
+	if _, err := selectText(context.Background(), db, selector{}); !errors.Is(err, errNoUnposted) {
+		t.Errorf("expected errNoUnposted without a cooldown, got %v", err)
+	}
+}
+
 // ===================== createTweetV2 =====================
 
 func TestCreateTweetV2_Success(t *testing.T) {
@@ -427,7 +1180,7 @@ func TestCreateTweetV2_Success(t *testing.T) {
 		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
 	}
 
-	id, err := createTweetV2(client, "Hello world", nil)
+	id, err := createTweetV2(client, "Hello world", nil, tweetOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -460,7 +1213,7 @@ func TestCreateTweetV2_WithMedia(t *testing.T) {
 		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
 	}
 
-	id, err := createTweetV2(client, "Post with images", []string{"media1", "media2"})
+	id, err := createTweetV2(client, "Post with images", []string{"media1", "media2"}, tweetOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -480,7 +1233,7 @@ func TestCreateTweetV2_HTTPError(t *testing.T) {
 		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
 	}
 
-	_, err := createTweetV2(client, "fail", nil)
+	_, err := createTweetV2(client, "fail", nil, tweetOptions{})
 	if err == nil {
 		t.Fatal("expected error for 403 response")
 	}
@@ -489,10 +1242,208 @@ func TestCreateTweetV2_HTTPError(t *testing.T) {
 	}
 }
 
+func TestCreateTweetV2_TypedErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		body   string
+		check  func(error) bool
+	}{
+		{"rate limit", 429, map[string]string{"x-rate-limit-reset": "1700000000"}, `{"title":"Too Many Requests"}`,
+			func(err error) bool {
+				var e *RateLimitError
+				return errors.As(err, &e) && e.Reset.Unix() == 1700000000
+			}},
+		{"auth", 401, nil, `{"title":"Unauthorized","detail":"Unauthorized"}`,
+			func(err error) bool { var e *AuthError; return errors.As(err, &e) }},
+		{"duplicate v2", 403, nil, `{"detail":"You are not allowed to create a Tweet with duplicate content.","title":"Forbidden"}`,
+			func(err error) bool { var e *DuplicateError; return errors.As(err, &e) }},
+		{"duplicate v1", 403, nil, `{"errors":[{"code":187,"message":"Status is a duplicate."}]}`,
+			func(err error) bool { var e *DuplicateError; return errors.As(err, &e) }},
+		{"other", 500, nil, `oops`,
+			func(err error) bool {
+				var e *APIError
+				var dup *DuplicateError
+				return errors.As(err, &e) && e.StatusCode == 500 && e.Body == "oops" && !errors.As(err, &dup)
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+			_, err := createTweetV2(client, "verse", nil, tweetOptions{})
+			if err == nil || !tt.check(err) {
+				t.Errorf("unexpected error type %T: %v", err, err)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Errorf("expected an APIError with status %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+// ===================== verifyCredentials =====================
+
+func TestVerifyCredentials_Valid(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/2/users/me" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"data":{"id":"1","name":"Portable Buddha","username":"portablebuddha"}}`))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+	}
+
+	handle, err := verifyCredentials(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handle != "portablebuddha" {
+		t.Errorf("expected handle portablebuddha, got %s", handle)
+	}
+}
+
+func TestVerifyCredentials_Invalid(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+		w.Write([]byte(`{"title":"Unauthorized","detail":"Unauthorized","type":"about:blank"}`))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+	}
+
+	_, err := verifyCredentials(client)
+	if err == nil {
+		t.Fatal("expected error for 401 response")
+	}
+	if !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("expected Unauthorized in error, got: %v", err)
+	}
+}
+
+func TestCreateTweetV2_RequestFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    tweetOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "plain",
+			want:    []string{`"text":"verse"`},
+			notWant: []string{`"reply"`, `"quote_tweet_id"`},
+		},
+		{
+			name:    "reply",
+			opts:    tweetOptions{InReplyTo: "111"},
+			want:    []string{`"reply":{"in_reply_to_tweet_id":"111"}`},
+			notWant: []string{`"quote_tweet_id"`},
+		},
+		{
+			name:    "quote",
+			opts:    tweetOptions{QuoteTweetID: "222"},
+			want:    []string{`"quote_tweet_id":"222"`},
+			notWant: []string{`"reply"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+				w.Write([]byte(`{"data":{"id":"1"}}`))
+			}))
+			defer srv.Close()
+
+			client := &http.Client{
+				Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+			}
+			if _, err := createTweetV2(client, "verse", nil, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(body, w) {
+					t.Errorf("expected %s in request body: %s", w, body)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(body, w) {
+					t.Errorf("did not expect %s in request body: %s", w, body)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateTweetV2_Poll(t *testing.T) {
+	var req model.TweetReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"data":{"id":"1"}}`))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+	}
+
+	poll, err := parsePoll("Yes, No , Not yet", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createTweetV2(client, "verse", nil, tweetOptions{Poll: poll}); err != nil {
+		t.Fatal(err)
+	}
+	if req.Poll == nil {
+		t.Fatal("expected poll in request")
+	}
+	if strings.Join(req.Poll.Options, "|") != "Yes|No|Not yet" || req.Poll.DurationMinutes != 60 {
+		t.Errorf("unexpected poll: %+v", req.Poll)
+	}
+}
+
+func TestCreateTweetV2_PollWithMedia(t *testing.T) {
+	poll := &model.TweetPoll{Options: []string{"a", "b"}, DurationMinutes: 60}
+	_, err := createTweetV2(http.DefaultClient, "verse", []string{"m1"}, tweetOptions{Poll: poll})
+	if !errors.Is(err, errPollWithMedia) {
+		t.Errorf("expected errPollWithMedia, got %v", err)
+	}
+}
+
+func TestParsePoll(t *testing.T) {
+	if p, err := parsePoll("", 60); p != nil || err != nil {
+		t.Errorf("parsePoll(empty) = %v, %v; want nil, nil", p, err)
+	}
+	for _, bad := range []string{"only", "a,b,c,d,e", "a,this option is far too long to fit"} {
+		if _, err := parsePoll(bad, 60); err == nil {
+			t.Errorf("parsePoll(%q) = nil error, want error", bad)
+		}
+	}
+	if _, err := parsePoll("a,b", 1); err == nil {
+		t.Error("expected error for a too-short duration")
+	}
+}
+
 // ===================== uploadImages =====================
 
 func TestUploadImages_Empty(t *testing.T) {
-	ids, err := uploadImages(http.DefaultClient, nil)
+	ids, err := uploadImages(http.DefaultClient, nil, uploadOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -507,7 +1458,7 @@ func TestUploadImages_CapsAtFour(t *testing.T) {
 	var paths []string
 	for i := 0; i < 5; i++ {
 		p := filepath.Join(dir, string(rune('a'+i))+".jpg")
-		os.WriteFile(p, []byte("fake-image-data"), 0644)
+		os.WriteFile(p, fakeJPEG, 0644)
 		paths = append(paths, p)
 	}
 
@@ -525,7 +1476,7 @@ func TestUploadImages_CapsAtFour(t *testing.T) {
 		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
 	}
 
-	ids, err := uploadImages(client, paths)
+	ids, err := uploadImages(client, paths, uploadOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -535,12 +1486,341 @@ func TestUploadImages_CapsAtFour(t *testing.T) {
 	}
 }
 
+func TestUploadImages_SizeLimit(t *testing.T) {
+	// A 6MB JPEG: too big for X's 5MB default, fine under a 10MB limit.
+	path := filepath.Join(t.TempDir(), "big.jpg")
+	data := append(append([]byte{}, fakeJPEG...), make([]byte, 6<<20-len(fakeJPEG))...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	var appended int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmd := r.FormValue("command")
+		commands = append(commands, cmd)
+		switch cmd {
+		case "INIT":
+			if r.FormValue("total_bytes") != strconv.Itoa(len(data)) {
+				t.Errorf("INIT total_bytes = %q", r.FormValue("total_bytes"))
+			}
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "big"})
+		case "APPEND":
+			f, _, err := r.FormFile("media")
+			if err != nil {
+				t.Errorf("APPEND without media: %v", err)
+				return
+			}
+			b, _ := io.ReadAll(f)
+			appended += len(b)
+			w.WriteHeader(http.StatusNoContent)
+		case "FINALIZE":
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "big"})
+		default:
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "simple"})
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+	_, err := uploadImages(client, []string{path}, uploadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "6.0MB, over the 5.0MB upload limit") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+	if len(commands) != 0 {
+		t.Errorf("nothing should be uploaded over the limit, got %v", commands)
+	}
+
+	ids, err := uploadImages(client, []string{path}, uploadOptions{MaxSize: 10 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "big" {
+		t.Errorf("expected media id big, got %v", ids)
+	}
+	if commands[0] != "INIT" || commands[len(commands)-1] != "FINALIZE" {
+		t.Errorf("expected chunked INIT…FINALIZE, got %v", commands)
+	}
+	if appended != len(data) {
+		t.Errorf("appended %d bytes, want %d", appended, len(data))
+	}
+}
+
+func TestXPoster_SensitiveMedia(t *testing.T) {
+	img := filepath.Join(t.TempDir(), "1.jpg")
+	os.WriteFile(img, fakeJPEG, 0644)
+
+	var meta []model.MediaMetadataReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.1/media/upload.json":
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "m1"})
+		case "/1.1/media/metadata/create.json":
+			var m model.MediaMetadataReq
+			json.NewDecoder(r.Body).Decode(&m)
+			meta = append(meta, m)
+		case "/2/tweets":
+			w.Write([]byte(`{"data":{"id":"1"}}`))
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+	if _, err := (&xPoster{client: client}).Post(context.Background(), "verse", []string{img}); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta) != 0 {
+		t.Fatalf("expected no metadata calls by default, got %+v", meta)
+	}
+
+	p := &xPoster{client: client, upload: uploadOptions{Sensitive: true}}
+	if _, err := p.Post(context.Background(), "verse", []string{img}); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta) != 1 || meta[0].MediaID != "m1" || strings.Join(meta[0].SensitiveMediaWarning, ",") != "other" {
+		t.Errorf("expected m1 marked sensitive, got %+v", meta)
+	}
+}
+
+func TestXPoster_RetryReusesMediaIDs(t *testing.T) {
+	img := filepath.Join(t.TempDir(), "1.jpg")
+	os.WriteFile(img, fakeJPEG, 0644)
+
+	uploads, tweets := 0, 0
+	tweetStatus := []int{503, 400, 200} // failure, expired media, success
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.1/media/upload.json":
+			uploads++
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: fmt.Sprintf("m%d", uploads)})
+		case "/2/tweets":
+			code := tweetStatus[tweets]
+			tweets++
+			w.WriteHeader(code)
+			switch code {
+			case 400:
+				w.Write([]byte(`{"detail":"Your media IDs are invalid.","title":"Invalid Request"}`))
+			case 200:
+				w.Write([]byte(`{"data":{"id":"1"}}`))
+			}
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+	p := &xPoster{client: client}
+
+	// The tweet fails after the upload; the retry reuses the media id.
+	if _, err := p.Post(context.Background(), "verse", []string{img}); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if uploads != 1 {
+		t.Fatalf("expected 1 upload, got %d", uploads)
+	}
+
+	// The retry is told the cached id is invalid, so it uploads once more.
+	if _, err := p.Post(context.Background(), "verse", []string{img}); err != nil {
+		t.Fatal(err)
+	}
+	if uploads != 2 || tweets != 3 {
+		t.Errorf("expected 2 uploads and 3 tweet attempts, got %d and %d", uploads, tweets)
+	}
+}
+
+func TestUploadImages_Concurrency(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 4; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("%d.jpg", i))
+		os.WriteFile(p, fakeJPEG, 0644)
+		paths = append(paths, p)
+	}
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	// The first two uploads wait for each other, and 0.jpg waits for 1.jpg to
+	// finish, so two are in flight at once and replies arrive out of order.
+	both, done1 := make(chan struct{}), make(chan struct{})
+	var bothOnce sync.Once
+	wait := func(ch chan struct{}) {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Error("timed out waiting for a concurrent upload")
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		if inFlight == 2 {
+			bothOnce.Do(func() { close(both) })
+		}
+		mu.Unlock()
+		_, fh, _ := r.FormFile("media")
+		switch fh.Filename {
+		case "0.jpg":
+			wait(both)
+			wait(done1)
+		case "1.jpg":
+			wait(both)
+			defer close(done1)
+		}
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "m" + fh.Filename})
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+	ids, err := uploadImages(client, paths, uploadOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "m0.jpg,m1.jpg,m2.jpg,m3.jpg" {
+		t.Errorf("media ids out of order: %v", ids)
+	}
+	if peak != 2 {
+		t.Errorf("expected 2 uploads in flight, got %d", peak)
+	}
+}
+
+func TestUploadModeFor(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		mode    string
+		size    int64
+		want    string
+		wantErr string
+	}{
+		{"", 1 * mb, uploadSimple, ""},
+		{uploadAuto, 1 * mb, uploadSimple, ""},
+		{uploadAuto, 5*mb + 1, "", "over the 5.0MB upload limit"},
+		{uploadSimple, 1 * mb, uploadSimple, ""},
+		{uploadChunked, 1 * mb, uploadChunked, ""},
+		{uploadChunked, 6 * mb, "", "over the 5.0MB upload limit"},
+		{"bogus", 1 * mb, "", "unknown upload mode"},
+	}
+	for _, tt := range tests {
+		got, err := uploadModeFor(tt.size, uploadOptions{Mode: tt.mode})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("mode %q size %d: expected error %q, got %v", tt.mode, tt.size, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("mode %q size %d = %q, %v; want %q", tt.mode, tt.size, got, err, tt.want)
+		}
+	}
+
+	// With a larger hard max, auto switches to chunked above the simple
+	// limit, and forcing simple is refused rather than truncated.
+	big := uploadOptions{MaxSize: 10 * mb}
+	if got, _ := uploadModeFor(6*mb, big); got != uploadChunked {
+		t.Errorf("auto at 6MB = %q, want chunked", got)
+	}
+	big.Mode = uploadSimple
+	if _, err := uploadModeFor(6*mb, big); err == nil || !strings.Contains(err.Error(), "simple upload limit") {
+		t.Errorf("expected forced simple to refuse 6MB, got %v", err)
+	}
+}
+
+func TestXPoster_BestEffortMedia(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 3; i++ {
+		p := filepath.Join(dir, string(rune('a'+i))+".jpg")
+		os.WriteFile(p, fakeJPEG, 0644)
+		paths = append(paths, p)
+	}
+
+	newServer := func(tweet *model.TweetReq) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/1.1/media/upload.json":
+				_, fh, _ := r.FormFile("media")
+				if fh.Filename == "b.jpg" {
+					w.WriteHeader(500)
+					w.Write([]byte("upload failed"))
+					return
+				}
+				json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "m-" + fh.Filename})
+			case "/2/tweets":
+				json.NewDecoder(r.Body).Decode(tweet)
+				w.Write([]byte(`{"data":{"id":"1"}}`))
+			}
+		}))
+	}
+
+	// Strict (default): the second failure aborts the post.
+	var tweet model.TweetReq
+	srv := newServer(&tweet)
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+	if _, err := (&xPoster{client: client}).Post(context.Background(), "verse", paths); err == nil {
+		t.Fatal("expected error when an upload fails")
+	}
+	if tweet.Text != "" {
+		t.Error("no tweet should be created when an upload fails")
+	}
+
+	// Best effort: the tweet goes out with the two good media ids.
+	p := &xPoster{client: client, upload: uploadOptions{BestEffort: true}}
+	if _, err := p.Post(context.Background(), "verse", paths); err != nil {
+		t.Fatal(err)
+	}
+	if tweet.Media == nil || strings.Join(tweet.Media.MediaIDs, ",") != "m-a.jpg,m-c.jpg" {
+		t.Errorf("expected media [m-a.jpg m-c.jpg], got %+v", tweet.Media)
+	}
+}
+
+func TestXPoster_MaxMedia(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 3; i++ {
+		p := filepath.Join(dir, string(rune('a'+i))+".jpg")
+		os.WriteFile(p, fakeJPEG, 0644)
+		paths = append(paths, p)
+	}
+
+	var uploaded []string
+	var tweet model.TweetReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.1/media/upload.json":
+			_, fh, _ := r.FormFile("media")
+			uploaded = append(uploaded, fh.Filename)
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "m" + fh.Filename})
+		case "/2/tweets":
+			json.NewDecoder(r.Body).Decode(&tweet)
+			w.Write([]byte(`{"data":{"id":"1"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := &xPoster{
+		client: &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}},
+		upload: uploadOptions{MaxMedia: 1},
+	}
+	if _, err := p.Post(context.Background(), "verse", paths); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 1 || uploaded[0] != "a.jpg" {
+		t.Errorf("expected only the first image uploaded, got %v", uploaded)
+	}
+	if tweet.Media == nil || len(tweet.Media.MediaIDs) != 1 {
+		t.Errorf("expected one media id on the tweet, got %+v", tweet.Media)
+	}
+}
+
 // ===================== uploadMediaSimple =====================
 
 func TestUploadMediaSimple_Success(t *testing.T) {
 	dir := t.TempDir()
 	imgPath := filepath.Join(dir, "test.jpg")
-	os.WriteFile(imgPath, []byte("fake-image-data"), 0644)
+	os.WriteFile(imgPath, fakeJPEG, 0644)
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
@@ -562,7 +1842,7 @@ func TestUploadMediaSimple_Success(t *testing.T) {
 		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
 	}
 
-	id, err := uploadMediaSimple(client, imgPath)
+	id, err := uploadMediaSimple(context.Background(), client, imgPath)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -574,7 +1854,7 @@ func TestUploadMediaSimple_Success(t *testing.T) {
 func TestUploadMediaSimple_NumericFallback(t *testing.T) {
 	dir := t.TempDir()
 	imgPath := filepath.Join(dir, "test.jpg")
-	os.WriteFile(imgPath, []byte("fake"), 0644)
+	os.WriteFile(imgPath, fakeJPEG, 0644)
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -589,7 +1869,7 @@ func TestUploadMediaSimple_NumericFallback(t *testing.T) {
 		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
 	}
 
-	id, err := uploadMediaSimple(client, imgPath)
+	id, err := uploadMediaSimple(context.Background(), client, imgPath)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -601,7 +1881,7 @@ func TestUploadMediaSimple_NumericFallback(t *testing.T) {
 func TestUploadMediaSimple_MissingMediaID(t *testing.T) {
 	dir := t.TempDir()
 	imgPath := filepath.Join(dir, "test.jpg")
-	os.WriteFile(imgPath, []byte("fake"), 0644)
+	os.WriteFile(imgPath, fakeJPEG, 0644)
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -613,7 +1893,7 @@ func TestUploadMediaSimple_MissingMediaID(t *testing.T) {
 		Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
 	}
 
-	_, err := uploadMediaSimple(client, imgPath)
+	_, err := uploadMediaSimple(context.Background(), client, imgPath)
 	if err == nil {
 		t.Fatal("expected error for missing media_id")
 	}
@@ -622,6 +1902,88 @@ func TestUploadMediaSimple_MissingMediaID(t *testing.T) {
 	}
 }
 
+func TestUploadMediaSimple_MediaCategory(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		wantType     string
+		wantCategory string
+	}{
+		{"png", []byte("\x89PNG\r\n\x1a\nfake-png-data"), "image/png", "tweet_image"},
+		{"static gif", []byte("GIF89afake-gif-data"), "image/gif", "tweet_image"},
+		{"animated gif", animatedGIF(t), "image/gif", "tweet_gif"},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 fake"), "image/webp", "tweet_image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imgPath := filepath.Join(t.TempDir(), "img")
+			os.WriteFile(imgPath, tt.data, 0644)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseMultipartForm(1 << 20); err != nil {
+					t.Errorf("parse multipart: %v", err)
+					return
+				}
+				if got := r.FormValue("media_category"); got != tt.wantCategory {
+					t.Errorf("media_category = %q, want %q", got, tt.wantCategory)
+				}
+				if got := r.FormValue("media_type"); got != tt.wantType {
+					t.Errorf("media_type = %q, want %q", got, tt.wantType)
+				}
+				json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "1"})
+			}))
+			defer srv.Close()
+
+			client := &http.Client{
+				Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+			}
+			if _, err := uploadMediaSimple(context.Background(), client, imgPath); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestUploadMediaSimple_UnsupportedType(t *testing.T) {
+	tests := map[string][]byte{
+		"avif": []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00"),
+		"text": []byte("not an image"),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			imgPath := filepath.Join(t.TempDir(), "img")
+			os.WriteFile(imgPath, data, 0644)
+
+			_, err := uploadMediaSimple(context.Background(), http.DefaultClient, imgPath)
+			if err == nil {
+				t.Fatal("expected error for unsupported media type")
+			}
+			if !strings.Contains(err.Error(), "supported: image/jpeg, image/png, image/gif, image/webp") {
+				t.Errorf("expected supported types in error, got: %v", err)
+			}
+		})
+	}
+}
+
+// fakeJPEG carries just enough of a JPEG header to pass content sniffing.
+var fakeJPEG = []byte("\xff\xd8\xff\xe0fake-image-data")
+
+// animatedGIF encodes a minimal two-frame GIF.
+func animatedGIF(t *testing.T) []byte {
+	t.Helper()
+	pal := color.Palette{color.Black, color.White}
+	frame := func() *image.Paletted { return image.NewPaletted(image.Rect(0, 0, 1, 1), pal) }
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image: []*image.Paletted{frame(), frame()},
+		Delay: []int{10, 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
 // ===================== rewriteTransport =====================
 
 // rewriteTransport redirects all HTTP requests to a local httptest server,
@@ -637,3 +1999,71 @@ func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	req.URL.Host = strings.TrimPrefix(rt.target, "http://")
 	return rt.base.RoundTrip(req)
 }
+
+func TestParseArgs(t *testing.T) {
+	cmd, cfg, err := parseArgs([]string{"peek", "-db", "x.sqlite"})
+	if err != nil || cmd != "peek" || cfg.dbPath != "x.sqlite" {
+		t.Errorf("peek -db x.sqlite: got %q %v", cmd, err)
+	}
+	if cmd, _, err := parseArgs([]string{"-db", "x.sqlite"}); err != nil || cmd != "post" {
+		t.Errorf("no command word: got %q %v", cmd, err)
+	}
+	// A command word after the flags must not fall through to post.
+	if _, _, err := parseArgs([]string{"-db", "x.sqlite", "peek"}); err == nil || !strings.Contains(err.Error(), `"peek"`) {
+		t.Errorf("trailing command word: got %v", err)
+	}
+}
+
+func TestCommandList(t *testing.T) {
+	list := commandList()
+	for name := range commands {
+		if !strings.Contains(list, name) {
+			t.Errorf("command list %q lacks %s", list, name)
+		}
+	}
+	if !strings.HasSuffix(list, " or verify-db") {
+		t.Errorf("command list = %q", list)
+	}
+}
+
+func TestCheckMaxLen(t *testing.T) {
+	for _, tt := range []struct {
+		platform string
+		maxLen   int
+		ok       bool
+	}{
+		{platformX, 0, true},
+		{platformX, xPremiumMaxLen, true},
+		{platformX, xPremiumMaxLen + 1, false},
+		{platformDiscord, discordMaxLen, true},
+		{platformDiscord, 3000, false},
+		{platformTelegram, telegramMaxLen, true},
+		{platformTelegram, 2000, false},
+	} {
+		if err := checkMaxLen(tt.platform, tt.maxLen); (err == nil) != tt.ok {
+			t.Errorf("checkMaxLen(%s, %d) = %v", tt.platform, tt.maxLen, err)
+		}
+	}
+}
+
+func TestCheckXOnlyFlags(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+	for _, tt := range []struct {
+		cfg config
+		ok  bool
+	}{
+		{config{platform: platformX, scheduleAt: at}, true},
+		{config{platform: platformDiscord}, true},
+		{config{platform: platformDiscord, scheduleAt: at}, false},
+		{config{platform: platformTelegram, scheduleAt: at}, false},
+		{config{platform: platformX, pollOpts: "a,b", upload: uploadOptions{Mode: uploadChunked, Concurrency: 4}}, true},
+		{config{platform: platformDiscord, upload: uploadOptions{Concurrency: 1}}, true},
+		{config{platform: platformDiscord, pollOpts: "a,b"}, false},
+		{config{platform: platformTelegram, upload: uploadOptions{Mode: uploadAuto}}, false},
+		{config{platform: platformTelegram, upload: uploadOptions{Concurrency: 2}}, false},
+	} {
+		if err := checkXOnlyFlags(&tt.cfg); (err == nil) != tt.ok {
+			t.Errorf("checkXOnlyFlags(%+v) = %v", tt.cfg, err)
+		}
+	}
+}
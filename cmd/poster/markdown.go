@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+// verseNumber is the first verse number in a label, e.g. 58 for "58–59", or
+// 0 if the label does not start with one.
+func verseNumber(label string) int {
+	n, _ := strconv.Atoi(leadingDigits.FindString(strings.TrimSpace(label)))
+	return n
+}
+
+var leadingDigits = regexp.MustCompile(`^[0-9]+`)
+
+// versesInRange keeps the verses whose first verse number lies in
+// [minVerse, maxVerse]; a bound of 0 is open.
+func versesInRange(texts []*model.Text, minVerse, maxVerse int) []*model.Text {
+	if minVerse <= 0 && maxVerse <= 0 {
+		return texts
+	}
+	var out []*model.Text
+	for _, t := range texts {
+		n := verseNumber(t.Label)
+		if (minVerse > 0 && n < minVerse) || (maxVerse > 0 && n > maxVerse) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// writeMarkdown writes one "### Verse <label>" section per verse, under
+// "## <chapter>" headings when any verse has a chapter.
+func writeMarkdown(w io.Writer, texts []*model.Text) error {
+	hasChapters := false
+	for _, t := range texts {
+		if strings.TrimSpace(t.Chapter) != "" {
+			hasChapters = true
+			break
+		}
+	}
+	bw := bufio.NewWriter(w)
+	sep := ""
+	for _, ch := range groupChapters(texts) {
+		if hasChapters {
+			bw.WriteString(sep + "## " + markdownEscape(ch.Title) + "\n")
+			sep = "\n"
+		}
+		for _, t := range ch.Verses {
+			bw.WriteString(sep + "### Verse " + markdownEscape(t.Label) + "\n\n" + markdownEscape(strings.TrimSpace(t.Body)) + "\n")
+			sep = "\n"
+		}
+	}
+	return bw.Flush()
+}
+
+// markdownInline matches characters that are Markdown syntax anywhere in a
+// line; markdownLineStart those that are only at the start of one (headings,
+// quotes, list items).
+var (
+	markdownInline    = regexp.MustCompile("[\\\\`*_\\[\\]<>|~]")
+	markdownLineStart = regexp.MustCompile(`(?m)^(\s*)([#>+-]|[0-9]+[.)])`)
+)
+
+// markdownEscape backslash-escapes s so it renders as plain text.
+func markdownEscape(s string) string {
+	s = markdownInline.ReplaceAllString(s, `\$0`)
+	return markdownLineStart.ReplaceAllStringFunc(s, func(m string) string {
+		i := len(m) - 1 // the marker, or the "." or ")" after a number
+		return m[:i] + `\` + m[i:]
+	})
+}
+
+// exportMarkdown writes the verses numbered minVerse..maxVerse (0 for no
+// bound), in verse order, to path.
+func exportMarkdown(ctx context.Context, db *DB, path string, minVerse, maxVerse int) error {
+	texts, err := allTexts(ctx, db)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeMarkdown(f, versesInRange(texts, minVerse, maxVerse)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
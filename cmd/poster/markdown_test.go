@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	texts := []*model.Text{
+		{Label: "1", Body: "Mind precedes all *mental* states.", Chapter: "Twin Verses"},
+		{Label: "2", Body: "As a shadow_that never leaves.", Chapter: "Twin Verses"},
+		{Label: "21", Body: "# not a heading\n1. not a list", Chapter: "Heedfulness"},
+	}
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, texts); err != nil {
+		t.Fatal(err)
+	}
+	want := `## Twin Verses
+
+### Verse 1
+
+Mind precedes all \*mental\* states.
+
+### Verse 2
+
+As a shadow\_that never leaves.
+
+## Heedfulness
+
+### Verse 21
+
+\# not a heading
+1\. not a list
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if n := strings.Count(buf.String(), "### Verse "); n != len(texts) {
+		t.Errorf("%d verse sections, want %d", n, len(texts))
+	}
+}
+
+func TestWriteMarkdown_NoChapters(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, []*model.Text{{Label: "1", Body: "One."}, {Label: "2", Body: "Two."}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "### Verse 1\n\nOne.\n\n### Verse 2\n\nTwo.\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestVersesInRange(t *testing.T) {
+	var texts []*model.Text
+	for _, l := range []string{"1", "2", "58–59", "60", "423"} {
+		texts = append(texts, &model.Text{Label: l})
+	}
+	var got []string
+	for _, t := range versesInRange(texts, 2, 60) {
+		got = append(got, t.Label)
+	}
+	if strings.Join(got, ",") != "2,58–59,60" {
+		t.Errorf("verses 2..60 = %v", got)
+	}
+	if n := len(versesInRange(texts, 0, 0)); n != len(texts) {
+		t.Errorf("unbounded range kept %d of %d", n, len(texts))
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const xTokenURL = "https://api.x.com/2/oauth2/token"
+
+// oauth2Token is an OAuth2 user-context token pair, as stored in -token-store.
+type oauth2Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// oauth2Transport authenticates requests with an OAuth2 bearer token. On a
+// 401 it refreshes the access token once via the token endpoint and retries
+// the request, saving the new tokens to store when one is set.
+type oauth2Transport struct {
+	base         http.RoundTripper // nil means httpTransport
+	tokenURL     string            // xTokenURL, or a test server
+	clientID     string
+	clientSecret string // empty for public clients
+	store        string // -token-store path; "" keeps tokens in memory only
+
+	mu  sync.Mutex
+	tok oauth2Token
+}
+
+func (t *oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	access := t.tok.AccessToken
+	t.mu.Unlock()
+
+	resp, err := t.send(req, access)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil // the body cannot be replayed
+	}
+	if err := t.refresh(access); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("refreshing the X access token: %w", err)
+	}
+	resp.Body.Close()
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	access = t.tok.AccessToken
+	t.mu.Unlock()
+	return t.send(retry, access)
+}
+
+func (t *oauth2Transport) send(req *http.Request, access string) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+access)
+	return t.transport().RoundTrip(r)
+}
+
+func (t *oauth2Transport) transport() http.RoundTripper {
+	if t.base == nil {
+		return httpTransport
+	}
+	return t.base
+}
+
+// refresh exchanges the refresh token for a new access token, unless another
+// request already replaced the stale one.
+func (t *oauth2Transport) refresh(stale string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tok.AccessToken != stale {
+		return nil
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.tok.RefreshToken},
+		"client_id":     {t.clientID},
+	}
+	req, err := http.NewRequest(http.MethodPost, t.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if t.clientSecret != "" {
+		req.SetBasicAuth(t.clientID, t.clientSecret)
+	}
+	resp, err := t.transport().RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return httpError(resp, body, "token refresh")
+	}
+	var tok oauth2Token
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return err
+	}
+	if tok.AccessToken == "" {
+		return errors.New("token response has no access_token")
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = t.tok.RefreshToken // not rotated
+	}
+	t.tok = tok
+	if t.store != "" {
+		return saveToken(t.store, tok)
+	}
+	return nil
+}
+
+// loadToken reads a token pair saved by saveToken; a missing file is not an
+// error and yields the zero token.
+func loadToken(path string) (oauth2Token, error) {
+	var tok oauth2Token
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tok, nil
+	}
+	if err != nil {
+		return tok, err
+	}
+	err = json.Unmarshal(b, &tok)
+	return tok, err
+}
+
+func saveToken(path string, tok oauth2Token) error {
+	b, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// newOAuth2HTTPClient returns a client using tok, refreshed as needed. Tokens
+// saved in store, when present, win over tok: X rotates refresh tokens, so
+// the stored pair is the newer one.
+func newOAuth2HTTPClient(clientID, clientSecret string, tok oauth2Token, store string) (*http.Client, error) {
+	if store != "" {
+		saved, err := loadToken(store)
+		if err != nil {
+			return nil, fmt.Errorf("reading -token-store: %w", err)
+		}
+		if saved.RefreshToken != "" {
+			tok = saved
+		}
+	}
+	return &http.Client{Transport: &oauth2Transport{
+		tokenURL:     xTokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		store:        store,
+		tok:          tok,
+	}}, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOAuth2Transport_RefreshesOn401(t *testing.T) {
+	var tweets, refreshes int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			refreshes++
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh-1" {
+				t.Errorf("token request form = %v", r.Form)
+			}
+			if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+				t.Errorf("token request basic auth = %q, %q", id, secret)
+			}
+			w.Write([]byte(`{"access_token":"fresh","refresh_token":"refresh-2","token_type":"bearer"}`))
+		case "/2/tweets":
+			tweets++
+			if r.Header.Get("Authorization") != "Bearer fresh" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"title":"Unauthorized"}`))
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), "Hello world") {
+				t.Errorf("retried request lost its body: %s", body)
+			}
+			w.Write([]byte(`{"data":{"id":"42"}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	store := filepath.Join(t.TempDir(), "token.json")
+	client := &http.Client{Transport: &oauth2Transport{
+		base:         rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+		tokenURL:     srv.URL + "/token",
+		clientID:     "client",
+		clientSecret: "secret",
+		store:        store,
+		tok:          oauth2Token{AccessToken: "expired", RefreshToken: "refresh-1"},
+	}}
+
+	id, err := createTweetV2(client, "Hello world", nil, tweetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "42" || tweets != 2 || refreshes != 1 {
+		t.Errorf("id %q after %d tweet requests and %d refreshes, want 42 after 2 and 1", id, tweets, refreshes)
+	}
+
+	saved, err := loadToken(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (oauth2Token{AccessToken: "fresh", RefreshToken: "refresh-2"}); saved != want {
+		t.Errorf("stored token = %+v, want %+v", saved, want)
+	}
+}
+
+func TestOAuth2Transport_RefreshOnlyOnce(t *testing.T) {
+	var refreshes int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			refreshes++
+			json.NewEncoder(w).Encode(oauth2Token{AccessToken: "still-bad"})
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &oauth2Transport{
+		base:     rewriteTransport{base: http.DefaultTransport, target: srv.URL},
+		tokenURL: srv.URL + "/token",
+		clientID: "client",
+		tok:      oauth2Token{AccessToken: "expired", RefreshToken: "refresh-1"},
+	}}
+
+	_, err := fetchMe(client)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Errorf("err = %v, want an AuthError", err)
+	}
+	if refreshes != 1 {
+		t.Errorf("%d refreshes, want 1", refreshes)
+	}
+}
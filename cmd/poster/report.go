@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+// imagesReport summarises which verses will post text-only and which already
+// have the full four images X takes (or more, for other platforms).
+type imagesReport struct {
+	Total      int      `json:"total"`
+	NoImages   []string `json:"no_images"`
+	FullImages []string `json:"full_images"`
+}
+
+// buildImagesReport runs deriveImagePaths for every label in texts.
+func buildImagesReport(ctx context.Context, db *DB, imagesDir string) (*imagesReport, error) {
+	rows, err := db.QueryContext(ctx, `SELECT label FROM {texts} ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rep := &imagesReport{NoImages: []string{}, FullImages: []string{}}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		paths, err := deriveImagePaths(imagesDir, label)
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", label, err)
+		}
+		rep.Total++
+		switch {
+		case len(paths) == 0:
+			rep.NoImages = append(rep.NoImages, label)
+		case len(paths) >= xMaxMedia:
+			rep.FullImages = append(rep.FullImages, label)
+		}
+	}
+	return rep, rows.Err()
+}
+
+func printImagesReport(w io.Writer, rep *imagesReport, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	fmt.Fprintf(w, "Verses: %d\n", rep.Total)
+	fmt.Fprintf(w, "Text-only (no images): %d\n", len(rep.NoImages))
+	if len(rep.NoImages) > 0 {
+		fmt.Fprintf(w, "  %s\n", strings.Join(rep.NoImages, "; "))
+	}
+	fmt.Fprintf(w, "With 4+ images: %d\n", len(rep.FullImages))
+	if len(rep.FullImages) > 0 {
+		fmt.Fprintf(w, "  %s\n", strings.Join(rep.FullImages, "; "))
+	}
+	return nil
+}
+
+// peek lists the next n verses the selector would post, without marking them.
+// It is exact for sequential order and a sample for random order.
+func peek(ctx context.Context, db *DB, sel selector, n int) ([]*model.Text, error) {
+	sel.skipIDs = append([]int64(nil), sel.skipIDs...)
+	var out []*model.Text
+	for len(out) < max(n, 1) {
+		t, err := selectText(ctx, db, sel)
+		if errors.Is(err, errNoUnposted) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+		sel.skipIDs = append(sel.skipIDs, t.ID)
+	}
+	return out, nil
+}
+
+func printPeek(w io.Writer, texts []*model.Text) {
+	const previewLen = 60
+	if len(texts) == 0 {
+		fmt.Fprintln(w, "(no unposted verses)")
+		return
+	}
+	for _, t := range texts {
+		body := strings.TrimSpace(t.Body)
+		if runeLen(body) > previewLen {
+			body = truncateRunes(body, previewLen) + "…"
+		}
+		fmt.Fprintf(w, "%s: %s\n", t.Label, body)
+	}
+}
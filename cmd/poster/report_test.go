@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildImagesReport(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	for i, label := range []string{"1", "2", "58, 59", "7"} {
+		db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (?, ?, 'verse')`, i+1, label)
+	}
+
+	imgDir := t.TempDir()
+	for _, name := range []string{"1.jpg", "7.jpg", "7-1.jpg", "7-2.png", "7-3.webp"} {
+		os.WriteFile(filepath.Join(imgDir, name), []byte("fake"), 0644)
+	}
+
+	rep, err := buildImagesReport(context.Background(), db, imgDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Total != 4 {
+		t.Errorf("total = %d, want 4", rep.Total)
+	}
+	if strings.Join(rep.NoImages, "|") != "2|58, 59" {
+		t.Errorf("no_images = %v, want [2 58, 59]", rep.NoImages)
+	}
+	if strings.Join(rep.FullImages, "|") != "7" {
+		t.Errorf("full_images = %v, want [7]", rep.FullImages)
+	}
+
+	var buf bytes.Buffer
+	if err := printImagesReport(&buf, rep, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded imagesReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if decoded.Total != 4 || len(decoded.NoImages) != 2 || len(decoded.FullImages) != 1 {
+		t.Errorf("unexpected decoded report: %+v", decoded)
+	}
+
+	buf.Reset()
+	printImagesReport(&buf, rep, false)
+	if !strings.Contains(buf.String(), "Text-only (no images): 2") {
+		t.Errorf("unexpected text report:\n%s", buf.String())
+	}
+}
+
+func TestPeek_Sequential(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	for i, label := range []string{"10", "2", "58, 59", "1", "3"} {
+		db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (?, ?, ?)`, i+1, label, strings.Repeat("long verse ", 10))
+	}
+	db.Exec(`UPDATE texts SET posted_at = '2025-01-01' WHERE label = '1'`)
+
+	texts, err := peek(context.Background(), db, selector{order: orderSeq}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, txt := range texts {
+		labels = append(labels, txt.Label)
+	}
+	if strings.Join(labels, "|") != "2|3|10" {
+		t.Errorf("peek labels = %v, want [2 3 10]", labels)
+	}
+
+	// Peeking must not mark anything posted.
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM texts WHERE posted_at IS NULL`).Scan(&n)
+	if n != 4 {
+		t.Errorf("%d unposted after peek, want 4", n)
+	}
+
+	var buf bytes.Buffer
+	printPeek(&buf, texts)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "2: long verse") || !strings.HasSuffix(lines[0], "…") {
+		t.Errorf("unexpected peek output:\n%s", buf.String())
+	}
+}
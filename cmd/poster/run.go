@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+// maxRateLimitWaits bounds how often a single post waits out a 429 before the
+// run gives up.
+const maxRateLimitWaits = 3
+
+// minRateLimitWait is the shortest wait before retrying a 429 that came
+// without a reset time, so -interval 0 does not retry at once.
+const minRateLimitWait = time.Minute
+
+// runner selects unposted verses and publishes them through a Poster.
+type runner struct {
+	db            *DB
+	poster        Poster
+	imagesDir     string
+	sel           selector
+	requireImages bool
+	count         int           // verses to post; < 1 is treated as 1
+	interval      time.Duration // pause between posts
+	status        statusOptions
+	upload        uploadOptions
+	noRepeat      bool   // skip verses whose body hash is in posted_hashes
+	chain         bool   // reply to the last post (kvLastPostID); poster must be a threadPoster
+	manifest      string // JSONL file each successful post is appended to; "" for none
+	platform      string // recorded in the manifest
+	scheduled     bool   // posts are scheduled (-schedule-at): ids are scheduled-tweet ids
+
+	// sleep waits for d or until ctx is done; nil means sleepCtx.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// next picks an unposted verse and resolves its usable images.
+func (r *runner) next(ctx context.Context) (*model.Text, error) {
+	t, err := r.pick(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.Images, err = usableImages(t.Images, r.requireImages)
+	if err != nil {
+		return nil, err
+	}
+	t.Images = r.capMedia(t.Images)
+	return t, nil
+}
+
+// capMedia keeps the first images, as many as r.poster takes per post.
+func (r *runner) capMedia(images []string) []string {
+	if ml, ok := r.poster.(mediaLimiter); ok && len(images) > ml.maxMedia() {
+		return images[:ml.maxMedia()]
+	}
+	return images
+}
+
+// pick picks an unposted verse with all the images found for it.
+func (r *runner) pick(ctx context.Context) (*model.Text, error) {
+	var t *model.Text
+	for {
+		var err error
+		t, err = selectTextAndImages(ctx, r.db, r.imagesDir, r.sel)
+		if err != nil {
+			return nil, err
+		}
+		if !r.noRepeat {
+			break
+		}
+		dup, err := bodyPosted(ctx, r.db, t.Body)
+		if err != nil {
+			return nil, err
+		}
+		if !dup {
+			break
+		}
+		log.Printf("Skipping text_id=%d (label=%s): identical body already posted", t.ID, t.Label)
+		r.sel.skipIDs = append(r.sel.skipIDs, t.ID)
+	}
+	return t, nil
+}
+
+// dryRun selects the next verse and renders it without posting, checking
+// each of its images against the upload limits. With record set it logs a
+// dry_run row in post_events; posted_at is left alone.
+func (r *runner) dryRun(ctx context.Context, record bool) (dryRunPreview, error) {
+	t, err := r.pick(ctx)
+	if err != nil {
+		return dryRunPreview{}, err
+	}
+	_, max := r.upload.limits()
+	checks := checkImages(t.Images, max)
+	t.Images, err = usableImages(t.Images, r.requireImages)
+	if err != nil {
+		return dryRunPreview{}, err
+	}
+	t.Images = r.capMedia(t.Images)
+	preview := newDryRunPreview(t, r.status)
+	preview.ImageChecks = checks
+	if record {
+		if err := recordEvent(ctx, r.db, t.ID, eventDryRun, preview.Status, ""); err != nil {
+			return dryRunPreview{}, err
+		}
+	}
+	return preview, nil
+}
+
+// postBatch posts up to r.count verses, pausing r.interval between them. Each
+// post is marked in the DB as soon as it succeeds, so a failure part-way
+// through keeps earlier posts. Running out of verses ends the batch early
+// without error once at least one verse was posted. A verse X rejects as a
+// duplicate is skipped for the rest of the run (and logged in post_events)
+// without counting toward r.count.
+func (r *runner) postBatch(ctx context.Context) (int, error) {
+	count := max(r.count, 1)
+	posted := 0
+	for posted < count {
+		// Stop between posts once interrupted; a post already under way is
+		// finished and marked (see postOne).
+		if err := ctx.Err(); err != nil {
+			return posted, err
+		}
+		t, err := r.next(ctx)
+		if errors.Is(err, errNoUnposted) && posted > 0 {
+			log.Printf("No unposted texts remain; stopping after %d post(s)", posted)
+			return posted, nil
+		}
+		if err != nil {
+			return posted, err
+		}
+		// Pause only once there is another verse to post.
+		if posted > 0 && r.interval > 0 {
+			if err := r.wait(ctx, r.interval); err != nil {
+				return posted, err
+			}
+		}
+		if err := r.postOne(ctx, t); err != nil {
+			var dup *DuplicateError
+			if !errors.As(err, &dup) {
+				return posted, err
+			}
+			// X already has this text. Leave the verse unposted (there is no
+			// post id to record) but skip it for the rest of this run, and
+			// note the rejection in post_events.
+			log.Printf("Skipping label=%s: X rejected it as duplicate content", t.Label)
+			r.sel.skipIDs = append(r.sel.skipIDs, t.ID)
+			status, _ := renderStatus(t, r.status)
+			if err := recordEvent(context.WithoutCancel(ctx), r.db, t.ID, eventDuplicate, status, ""); err != nil {
+				return posted, err
+			}
+			continue
+		}
+		posted++
+	}
+	return posted, nil
+}
+
+// postOne publishes t, waiting out rate limits, and marks it posted. Once a
+// post is sent, cancelling ctx no longer interrupts it: the post and its DB
+// commit complete, so no verse is left posted but unmarked. Only the
+// rate-limit waits, before anything is sent, are abandoned on cancellation.
+func (r *runner) postOne(ctx context.Context, t *model.Text) error {
+	sendCtx := context.WithoutCancel(ctx)
+
+	var replyTo string
+	if r.chain {
+		var err error
+		if replyTo, err = getKV(sendCtx, r.db, kvLastPostID); err != nil {
+			return err
+		}
+	}
+
+	var postID string
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id, err := r.post(sendCtx, t, replyTo)
+		if err == nil {
+			postID = id
+			break
+		}
+		var rl *RateLimitError
+		if !errors.As(err, &rl) || attempt >= maxRateLimitWaits {
+			return fmt.Errorf("post label=%s: %w", t.Label, err)
+		}
+		d := max(r.interval, minRateLimitWait)
+		if !rl.Reset.IsZero() {
+			d = time.Until(rl.Reset) + time.Second
+		}
+		log.Printf("Rate limited; waiting %s before retrying label=%s", d.Round(time.Second), t.Label)
+		if err := r.wait(ctx, d); err != nil {
+			return err
+		}
+	}
+	if r.scheduled {
+		return r.markScheduled(sendCtx, t, postID)
+	}
+	if r.platform == platformX {
+		log.Printf("Posted tweet ID %s: %s", postID, verseURL(postID))
+	} else {
+		log.Printf("Posted %s post ID %s", r.platform, postID)
+	}
+
+	// --- marks as posted ---
+	if err := markPosted(sendCtx, r.db, t, postID); err != nil {
+		return err
+	}
+	log.Printf("Marked text_id=%d (label=%s) as posted at %s", t.ID, t.Label, time.Now().Format(time.RFC3339))
+	if err := r.appendManifest(t, postID); err != nil {
+		return err
+	}
+	if r.chain {
+		return setKV(sendCtx, r.db, kvLastPostID, postID)
+	}
+	return nil
+}
+
+// markScheduled marks t posted, so it is not picked again, and records the
+// scheduled-tweet id in post_events. There is no tweet yet, so x_post_id,
+// the manifest and the -chain reply target are left alone.
+func (r *runner) markScheduled(ctx context.Context, t *model.Text, scheduledID string) error {
+	log.Printf("Scheduled label=%s as scheduled tweet %s", t.Label, scheduledID)
+	if err := markPosted(ctx, r.db, t, ""); err != nil {
+		return err
+	}
+	status, _ := renderStatus(t, r.status)
+	return recordEvent(ctx, r.db, t.ID, eventScheduled, status, scheduledID)
+}
+
+// edit replaces the post of an already posted verse with one of its current
+// text (say, after fixing a typo in the DB): it deletes the old post, which
+// may already be gone, posts afresh and records the new post id.
+func (r *runner) edit(ctx context.Context, label string) (string, error) {
+	dp, ok := r.poster.(deleterPoster)
+	if !ok {
+		return "", errors.New("this platform cannot delete posts")
+	}
+	t, oldID, err := postedText(ctx, r.db, label)
+	if err != nil {
+		return "", err
+	}
+	if t.Images, err = deriveImagePaths(r.imagesDir, t.Label); err != nil {
+		return "", err
+	}
+	if t.Images, err = usableImages(t.Images, r.requireImages); err != nil {
+		return "", err
+	}
+	t.Images = r.capMedia(t.Images)
+
+	switch err := dp.Delete(ctx, oldID); {
+	case errors.Is(err, errTweetGone):
+		log.Printf("Post %s of label=%s was already deleted", oldID, label)
+	case err != nil:
+		return "", fmt.Errorf("delete post %s: %w", oldID, err)
+	default:
+		log.Printf("Deleted post %s of label=%s", oldID, label)
+	}
+
+	id, err := r.post(ctx, t, "")
+	if err != nil {
+		return "", fmt.Errorf("post label=%s: %w", label, err)
+	}
+	if err := markPosted(ctx, r.db, t, id); err != nil {
+		return "", err
+	}
+	return id, r.appendManifest(t, id)
+}
+
+// postedText loads the verse with the given label and the id of its post.
+func postedText(ctx context.Context, db *DB, label string) (*model.Text, string, error) {
+	t := &model.Text{}
+	var postID string
+	err := db.QueryRowContext(ctx, `
+SELECT id, label, text_body, `+db.verseColumns()+`, COALESCE(x_post_id, '')
+FROM {texts}
+WHERE label = ?`, label).Scan(&t.ID, &t.Label, &t.Body, &t.Pali, &t.Chapter, &t.Attribution, &postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("no verse with label %q", label)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if postID == "" {
+		return nil, "", fmt.Errorf("verse %s has no recorded post to edit", label)
+	}
+	return t, postID, nil
+}
+
+// post publishes t through r.poster, as a reply when replyTo is set. With
+// -text-in-alt the body goes in the first image's alt text; should no image
+// upload to carry it, the verse is posted in full, text only, instead.
+func (r *runner) post(ctx context.Context, t *model.Text, replyTo string) (string, error) {
+	status, _ := renderStatus(t, r.status)
+	if alt := altText(t, r.status); alt != "" {
+		ap, ok := r.poster.(altTextPoster)
+		if !ok {
+			return "", errors.New("this platform cannot set image alt text")
+		}
+		id, err := ap.PostWithAlt(ctx, status, t.Images, replyTo, alt)
+		if !errors.Is(err, errAltTextLost) {
+			return id, err
+		}
+		log.Printf("No image of label=%s uploaded; posting the verse as text instead", t.Label)
+		o := r.status
+		o.TextInAlt = false
+		status, _ = renderStatus(t, o)
+		return r.postStatus(ctx, status, nil, replyTo)
+	}
+	return r.postStatus(ctx, status, t.Images, replyTo)
+}
+
+// postStatus publishes status and images, as a reply when replyTo is set.
+func (r *runner) postStatus(ctx context.Context, status string, images []string, replyTo string) (string, error) {
+	if replyTo == "" {
+		return r.poster.Post(ctx, status, images)
+	}
+	tp, ok := r.poster.(threadPoster)
+	if !ok {
+		return "", errors.New("this platform cannot post replies")
+	}
+	return tp.PostReply(ctx, status, images, replyTo)
+}
+
+func (r *runner) wait(ctx context.Context, d time.Duration) error {
+	if r.sleep != nil {
+		return r.sleep(ctx, d)
+	}
+	return sleepCtx(ctx, d)
+}
+
+// markPosted records the post id (NULL when empty) and remembers the body
+// hash, atomically.
+func markPosted(ctx context.Context, db *DB, t *model.Text, postID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE {texts} SET posted_at = CURRENT_TIMESTAMP, x_post_id = NULLIF(?, '') WHERE id = ?`,
+		postID, t.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO {posted_hashes} (hash, text_id, posted_at) VALUES (?, ?, CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING`,
+		bodyHash(t.Body), t.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// post_events statuses.
+const (
+	eventDryRun    = "dry_run"
+	eventDuplicate = "duplicate" // X rejected the post as duplicate content
+	eventScheduled = "scheduled" // post_id is the scheduled-tweet id
+)
+
+// recordEvent appends an audit row to post_events; postID may be empty.
+func recordEvent(ctx context.Context, db *DB, textID int64, status, body, postID string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO {post_events} (text_id, status, body, post_id, created_at) VALUES (?, ?, ?, NULLIF(?, ''), CURRENT_TIMESTAMP)`,
+		textID, status, body, postID)
+	return err
+}
+
+// manifestEntry is one line of the -manifest file.
+type manifestEntry struct {
+	VerseLabel string    `json:"verse_label"`
+	TweetID    string    `json:"tweet_id"` // the platform's post id: a Discord or Telegram message id off X
+	PostedAt   time.Time `json:"posted_at"`
+	Platform   string    `json:"platform"`
+	MediaCount int       `json:"media_count"`
+}
+
+// appendManifest appends a line for a successful post to r.manifest, if set.
+// Each line goes out in a single write to a file opened for appending and is
+// synced before returning, so the record outlives the DB and crashes alike.
+func (r *runner) appendManifest(t *model.Text, postID string) error {
+	if r.manifest == "" {
+		return nil
+	}
+	line, err := json.Marshal(manifestEntry{
+		VerseLabel: t.Label,
+		TweetID:    postID,
+		PostedAt:   time.Now().UTC(),
+		Platform:   r.platform,
+		MediaCount: len(t.Images),
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.manifest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("manifest: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("manifest: %w", err)
+	}
+	return f.Close()
+}
+
+// bodyHash identifies a verse body independently of its row, so reposts are
+// caught across DB copies and resets.
+func bodyHash(body string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(body)))
+	return hex.EncodeToString(sum[:])
+}
+
+func bodyPosted(ctx context.Context, db *DB, body string) (bool, error) {
+	if !db.has("posted_hashes") {
+		return false, nil
+	}
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM {posted_hashes} WHERE hash = ?`, bodyHash(body)).Scan(&n)
+	return n > 0, err
+}
+
+// kvLastPostID is the kv key holding the id of the last post, which -chain
+// replies to.
+const kvLastPostID = "last_post_id"
+
+// getKV returns the value stored under key, or "" if there is none.
+func getKV(ctx context.Context, db *DB, key string) (string, error) {
+	if !db.has("kv") {
+		return "", nil
+	}
+	var v string
+	err := db.QueryRowContext(ctx, `SELECT value FROM {kv} WHERE key = ?`, key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return v, err
+}
+
+func setKV(ctx context.Context, db *DB, key, value string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO {kv} (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		key, value)
+	return err
+}
+
+// sleepCtx sleeps for d, returning early with ctx's error if it is cancelled.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
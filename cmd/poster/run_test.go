@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikequentel/dhammapada/internal/model"
+)
+
+// mockPoster records each post and returns sequential ids; errs, if set, are
+// returned (in order) before any success.
+type mockPoster struct {
+	posts []string
+	errs  []error
+}
+
+func (m *mockPoster) Post(ctx context.Context, status string, images []string) (string, error) {
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return "", err
+	}
+	m.posts = append(m.posts, status)
+	return fmt.Sprintf("tweet-%d", len(m.posts)), nil
+}
+
+func noSleep(context.Context, time.Duration) error { return nil }
+
+func seedTexts(t *testing.T, n int) *runner {
+	t.Helper()
+	db := newTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	for i := 1; i <= n; i++ {
+		if _, err := db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (?, ?, ?)`,
+			i, fmt.Sprint(i), fmt.Sprintf("verse %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &runner{db: db, imagesDir: t.TempDir(), sleep: noSleep}
+}
+
+func countPosted(t *testing.T, r *runner) int {
+	t.Helper()
+	var n int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM texts WHERE posted_at IS NOT NULL AND x_post_id IS NOT NULL`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPostBatch_PostsCount(t *testing.T) {
+	r := seedTexts(t, 5)
+	mp := &mockPoster{}
+	r.poster, r.count, r.interval = mp, 3, time.Second
+
+	var waits []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	posted, err := r.postBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted != 3 || len(mp.posts) != 3 {
+		t.Errorf("posted %d (mock saw %d), want 3", posted, len(mp.posts))
+	}
+	if got := countPosted(t, r); got != 3 {
+		t.Errorf("%d rows marked posted, want 3", got)
+	}
+	if len(waits) != 2 {
+		t.Errorf("expected 2 pauses between 3 posts, got %v", waits)
+	}
+}
+
+func TestPostBatch_StopsWhenExhausted(t *testing.T) {
+	r := seedTexts(t, 2)
+	r.poster, r.count, r.interval = &mockPoster{}, 5, time.Minute
+
+	var waits []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	posted, err := r.postBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted != 2 {
+		t.Errorf("posted %d, want 2", posted)
+	}
+	if len(waits) != 1 {
+		t.Errorf("expected 1 pause between 2 posts and none after the last, got %v", waits)
+	}
+}
+
+func TestPostBatch_FailureKeepsEarlierPosts(t *testing.T) {
+	r := seedTexts(t, 3)
+	mp := &mockPoster{}
+	r.count = 3
+
+	// Let the first post through, then fail.
+	r.poster = posterFunc(func(ctx context.Context, status string, images []string) (string, error) {
+		if len(mp.posts) == 1 {
+			return "", errors.New("boom")
+		}
+		return mp.Post(ctx, status, images)
+	})
+
+	posted, err := r.postBatch(context.Background())
+	if err == nil {
+		t.Fatal("expected error from failing post")
+	}
+	if posted != 1 || countPosted(t, r) != 1 {
+		t.Errorf("posted %d, rows %d; want the first post kept", posted, countPosted(t, r))
+	}
+}
+
+func TestPostBatch_WaitsOutRateLimit(t *testing.T) {
+	r := seedTexts(t, 1)
+	reset := time.Now().Add(time.Minute)
+	mp := &mockPoster{errs: []error{&RateLimitError{APIError: &APIError{StatusCode: 429, msg: "429"}, Reset: reset}}}
+	r.poster = mp
+
+	var waits []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	posted, err := r.postBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted != 1 {
+		t.Errorf("posted %d, want 1", posted)
+	}
+	if len(waits) != 1 || waits[0] < 50*time.Second {
+		t.Errorf("expected one wait until the reset, got %v", waits)
+	}
+}
+
+func TestPostBatch_RateLimitWithoutResetBacksOff(t *testing.T) {
+	r := seedTexts(t, 1)
+	mp := &mockPoster{errs: []error{&RateLimitError{APIError: &APIError{StatusCode: 429, msg: "429"}}}}
+	r.poster = mp // r.interval is 0
+
+	var waits []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	if _, err := r.postBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(waits) != 1 || waits[0] < minRateLimitWait {
+		t.Errorf("expected one wait of at least %s, got %v", minRateLimitWait, waits)
+	}
+}
+
+func TestPostBatch_SkipsDuplicate(t *testing.T) {
+	r := seedTexts(t, 3)
+	mp := &mockPoster{errs: []error{&DuplicateError{&APIError{StatusCode: 403, msg: "duplicate"}}}}
+	r.poster, r.count = mp, 2
+
+	posted, err := r.postBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted != 2 || len(mp.posts) != 2 {
+		t.Errorf("posted %d, want 2 besides the duplicate", posted)
+	}
+	var n int
+	r.db.QueryRow(`SELECT COUNT(*) FROM texts WHERE posted_at IS NOT NULL AND x_post_id IS NULL`).Scan(&n)
+	if n != 0 {
+		t.Errorf("found %d rows posted without an id", n)
+	}
+	var events int
+	r.db.QueryRow(`SELECT COUNT(*) FROM post_events WHERE status = ?`, eventDuplicate).Scan(&events)
+	if events != 1 {
+		t.Errorf("recorded %d duplicate events, want 1", events)
+	}
+}
+
+func TestPostBatch_NoRepeatSkipsIdenticalBody(t *testing.T) {
+	r := seedTexts(t, 0)
+	r.db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (1, '1', 'The same words.')`)
+	r.poster = &mockPoster{}
+
+	if _, err := r.postBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second copy of the verse (e.g. after a DB reset) must not be reposted.
+	r.db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (2, '2', '  The same words. ')`)
+	r.noRepeat = true
+	if _, err := r.postBatch(context.Background()); !errors.Is(err, errNoUnposted) {
+		t.Fatalf("expected errNoUnposted once the repeat is skipped, got %v", err)
+	}
+
+	// A different verse is still posted.
+	r.db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (3, '3', 'Other words.')`)
+	mp := &mockPoster{}
+	r.poster = mp
+	if _, err := r.postBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.posts) != 1 || !strings.Contains(mp.posts[0], "Other words.") {
+		t.Errorf("expected verse 3 to be posted, got %v", mp.posts)
+	}
+	var posted sql.NullString
+	r.db.QueryRow(`SELECT posted_at FROM texts WHERE id = 2`).Scan(&posted)
+	if posted.Valid {
+		t.Error("the skipped repeat should stay unposted")
+	}
+}
+
+// posterFunc adapts a function to the Poster interface.
+type posterFunc func(ctx context.Context, status string, images []string) (string, error)
+
+func (f posterFunc) Post(ctx context.Context, status string, images []string) (string, error) {
+	return f(ctx, status, images)
+}
+
+func TestPostBatch_ChainRepliesToPreviousPost(t *testing.T) {
+	r := seedTexts(t, 2)
+	var replies []string
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var tweet model.TweetReq
+		json.NewDecoder(req.Body).Decode(&tweet)
+		reply := ""
+		if tweet.Reply != nil {
+			reply = tweet.Reply.InReplyToTweetID
+		}
+		replies = append(replies, reply)
+		n++
+		fmt.Fprintf(w, `{"data":{"id":"tweet-%d"}}`, n)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+	r.poster, r.chain = &xPoster{client: client}, true
+
+	// Two separate runs, as on two days.
+	for i := 0; i < 2; i++ {
+		if _, err := r.postBatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(replies) != 2 || replies[0] != "" || replies[1] != "tweet-1" {
+		t.Errorf("expected the second post to reply to tweet-1, got replies %q", replies)
+	}
+	if last, _ := getKV(context.Background(), r.db, kvLastPostID); last != "tweet-2" {
+		t.Errorf("expected last post id tweet-2, got %q", last)
+	}
+}
+
+func TestPostBatch_TextInAlt(t *testing.T) {
+	r := seedTexts(t, 1)
+	os.WriteFile(filepath.Join(r.imagesDir, "1.jpg"), fakeJPEG, 0644)
+	r.status.TextInAlt = true
+
+	var alt, status string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/1.1/media/upload.json":
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "m1"})
+		case "/1.1/media/metadata/create.json":
+			var meta model.MediaMetadataReq
+			json.NewDecoder(req.Body).Decode(&meta)
+			if meta.MediaID == "m1" && meta.AltText != nil {
+				alt = meta.AltText.Text
+			}
+		case "/2/tweets":
+			var tweet model.TweetReq
+			json.NewDecoder(req.Body).Decode(&tweet)
+			status = tweet.Text
+			w.Write([]byte(`{"data":{"id":"tweet-1"}}`))
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+	r.poster = &xPoster{client: client}
+
+	if _, err := r.postBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 — Dhammapada (F Max Müller) " + defaultHashtags; status != want {
+		t.Errorf("status = %q, want %q", status, want)
+	}
+	if alt != "verse 1" {
+		t.Errorf("alt text = %q, want the verse body", alt)
+	}
+}
+
+func TestPostBatch_TextInAltFallsBackWhenNoImageUploads(t *testing.T) {
+	r := seedTexts(t, 1)
+	os.WriteFile(filepath.Join(r.imagesDir, "1.jpg"), fakeJPEG, 0644)
+	r.status.TextInAlt = true
+
+	var tweet model.TweetReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/1.1/media/upload.json":
+			http.Error(w, `{"errors":[{"message":"Internal error"}]}`, http.StatusInternalServerError)
+		case "/2/tweets":
+			json.NewDecoder(req.Body).Decode(&tweet)
+			w.Write([]byte(`{"data":{"id":"tweet-1"}}`))
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+	r.poster = &xPoster{client: client, upload: uploadOptions{BestEffort: true}}
+
+	if _, err := r.postBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1: verse 1 — Dhammapada (F Max Müller) " + defaultHashtags; tweet.Text != want {
+		t.Errorf("status = %q, want the full verse %q", tweet.Text, want)
+	}
+	if tweet.Media != nil {
+		t.Errorf("expected a text-only post, got media %v", tweet.Media)
+	}
+}
+
+func TestXPoster_LongAltTextTruncated(t *testing.T) {
+	img := filepath.Join(t.TempDir(), "1.jpg")
+	os.WriteFile(img, fakeJPEG, 0644)
+	alt := strings.Repeat("Better than a thousand words. ", 40) // 1200 runes
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/1.1/media/upload.json":
+			json.NewEncoder(w).Encode(model.MediaUploadResp{MediaIDString: "m1"})
+		case "/1.1/media/metadata/create.json":
+			var meta model.MediaMetadataReq
+			json.NewDecoder(req.Body).Decode(&meta)
+			got = meta.AltText.Text
+		case "/2/tweets":
+			w.Write([]byte(`{"data":{"id":"1"}}`))
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+	if _, err := (&xPoster{client: client}).PostWithAlt(context.Background(), "1", []string{img}, "", alt); err != nil {
+		t.Fatal(err)
+	}
+	if n := runeLen(got); n > xMaxAltText || n < xMaxAltText-40 {
+		t.Errorf("alt text is %d runes, want just under %d", n, xMaxAltText)
+	}
+	kept, ok := strings.CutSuffix(got, "…")
+	if !ok || !strings.HasPrefix(alt, kept+" ") {
+		t.Errorf("expected a cut at a word, marked with an ellipsis: %q", got[len(got)-40:])
+	}
+}
+
+func TestPostBatch_InterruptFinishesInFlightPost(t *testing.T) {
+	r := seedTexts(t, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	posts := 0
+	r.poster = posterFunc(func(ctx context.Context, status string, images []string) (string, error) {
+		posts++
+		cancel() // Ctrl-C arrives while the post is in flight
+		if ctx.Err() != nil {
+			t.Error("the in-flight post should not see the cancellation")
+		}
+		return fmt.Sprintf("tweet-%d", posts), nil
+	})
+	r.count = 3
+
+	posted, err := r.postBatch(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if posted != 1 || posts != 1 {
+		t.Errorf("expected the batch to stop after the in-flight post, got posted=%d posts=%d", posted, posts)
+	}
+	if got := countPosted(t, r); got != 1 {
+		t.Errorf("expected the in-flight post marked, got %d", got)
+	}
+	var partial int
+	r.db.QueryRow(`SELECT COUNT(*) FROM texts WHERE posted_at IS NOT NULL AND x_post_id IS NULL`).Scan(&partial)
+	if partial != 0 {
+		t.Errorf("found %d rows posted without an id", partial)
+	}
+}
+
+func TestDryRun_RecordsEvent(t *testing.T) {
+	r := seedTexts(t, 1)
+	r.poster = posterFunc(func(context.Context, string, []string) (string, error) {
+		t.Error("a dry run must not post")
+		return "", nil
+	})
+
+	preview, err := r.dryRun(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status, body string
+	err = r.db.QueryRow(`SELECT status, body FROM post_events WHERE text_id = 1`).Scan(&status, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != eventDryRun || body != preview.Status {
+		t.Errorf("unexpected event %q %q", status, body)
+	}
+	var posted sql.NullString
+	r.db.QueryRow(`SELECT posted_at FROM texts WHERE id = 1`).Scan(&posted)
+	if posted.Valid {
+		t.Error("a dry run must not set posted_at")
+	}
+}
+
+func TestNext_CapsImagesPerPoster(t *testing.T) {
+	r := seedTexts(t, 1)
+	os.WriteFile(filepath.Join(r.imagesDir, "1.jpg"), fakeJPEG, 0644)
+	for i := 1; i < 12; i++ {
+		os.WriteFile(filepath.Join(r.imagesDir, fmt.Sprintf("1-%d.jpg", i)), fakeJPEG, 0644)
+	}
+	for _, tt := range []struct {
+		poster Poster
+		want   int
+	}{
+		{&xPoster{}, xMaxMedia},
+		{&discordPoster{}, discordMaxFiles},
+		{&telegramPoster{}, telegramMaxMedia},
+		{&mockPoster{}, 12}, // no limit of its own
+	} {
+		r.poster = tt.poster
+		text, err := r.next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(text.Images) != tt.want {
+			t.Errorf("%T: %d images, want %d", tt.poster, len(text.Images), tt.want)
+		}
+	}
+}
+
+func TestDryRun_ChecksImages(t *testing.T) {
+	r := seedTexts(t, 1)
+	r.upload.MaxSize = int64(len(fakeJPEG))
+	valid := filepath.Join(r.imagesDir, "1.jpg")
+	big := filepath.Join(r.imagesDir, "1-2.jpg")
+	missing := filepath.Join(r.imagesDir, "1-3.jpg")
+	os.WriteFile(valid, fakeJPEG, 0644)
+	os.WriteFile(big, append(append([]byte{}, fakeJPEG...), make([]byte, 100)...), 0644)
+	if err := os.Symlink(filepath.Join(r.imagesDir, "gone.jpg"), missing); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := r.dryRun(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.ImageChecks) != 3 {
+		t.Fatalf("got %d image checks, want 3: %+v", len(preview.ImageChecks), preview.ImageChecks)
+	}
+	checks := map[string]imageCheck{}
+	for _, c := range preview.ImageChecks {
+		checks[c.Path] = c
+	}
+	if c := checks[valid]; !c.Exists || c.OverLimit || c.ContentType != "image/jpeg" || c.Problem != "" {
+		t.Errorf("valid image flagged: %+v", c)
+	}
+	if c := checks[big]; !c.Exists || !c.OverLimit || c.Size != int64(len(fakeJPEG)+100) ||
+		!strings.Contains(c.Problem, "upload limit") {
+		t.Errorf("oversized image not flagged: %+v", c)
+	}
+	if c := checks[missing]; c.Exists || c.Problem == "" {
+		t.Errorf("missing image not flagged: %+v", c)
+	}
+	if len(preview.Images) != 2 {
+		t.Errorf("preview images = %v, want the two readable ones", preview.Images)
+	}
+
+	var buf bytes.Buffer
+	printDryRunPreview(&buf, preview)
+	if n := strings.Count(buf.String(), "✗"); n != 2 {
+		t.Errorf("report flags %d images, want 2:\n%s", n, buf.String())
+	}
+}
+
+func TestEdit_DeletesAndReposts(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		deleteCode int
+		deleteBody string
+	}{
+		{"deleted", http.StatusOK, `{"data":{"deleted":true}}`},
+		{"already gone", http.StatusNotFound, `{"title":"Not Found Error"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := seedTexts(t, 1)
+			r.db.Exec(`UPDATE texts SET posted_at = CURRENT_TIMESTAMP, x_post_id = 'old-1', text_body = 'verse 1, corrected' WHERE id = 1`)
+
+			var deleted, posted string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch {
+				case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/2/tweets/"):
+					deleted = strings.TrimPrefix(req.URL.Path, "/2/tweets/")
+					w.WriteHeader(tt.deleteCode)
+					w.Write([]byte(tt.deleteBody))
+				case req.Method == http.MethodPost && req.URL.Path == "/2/tweets":
+					var tweet model.TweetReq
+					json.NewDecoder(req.Body).Decode(&tweet)
+					posted = tweet.Text
+					w.Write([]byte(`{"data":{"id":"new-1"}}`))
+				default:
+					t.Errorf("unexpected %s %s", req.Method, req.URL.Path)
+				}
+			}))
+			defer srv.Close()
+			client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+			r.poster = &xPoster{client: client}
+
+			id, err := r.edit(context.Background(), "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != "old-1" {
+				t.Errorf("deleted %q, want old-1", deleted)
+			}
+			if id != "new-1" || !strings.Contains(posted, "verse 1, corrected") {
+				t.Errorf("posted %q as %q, want the corrected verse as new-1", posted, id)
+			}
+			var stored string
+			r.db.QueryRow(`SELECT x_post_id FROM texts WHERE id = 1`).Scan(&stored)
+			if stored != "new-1" {
+				t.Errorf("x_post_id = %q, want new-1", stored)
+			}
+		})
+	}
+}
+
+func TestEdit_NeedsRecordedPost(t *testing.T) {
+	r := seedTexts(t, 1)
+	r.poster = &xPoster{client: http.DefaultClient}
+	if _, err := r.edit(context.Background(), "1"); err == nil || !strings.Contains(err.Error(), "no recorded post") {
+		t.Errorf("expected an unposted verse to be refused, got %v", err)
+	}
+}
+
+func TestPostBatch_AppendsManifest(t *testing.T) {
+	r := seedTexts(t, 2)
+	os.WriteFile(filepath.Join(r.imagesDir, "1.jpg"), fakeJPEG, 0644)
+	r.poster, r.count, r.platform = &mockPoster{}, 2, platformX
+	r.manifest = filepath.Join(t.TempDir(), "manifest.jsonl")
+	os.WriteFile(r.manifest, []byte(`{"verse_label":"0","tweet_id":"earlier"}`+"\n"), 0644)
+
+	if _, err := r.postBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(r.manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected the earlier line plus two new ones, got %d:\n%s", len(lines), b)
+	}
+	media := map[string]int{}
+	for _, l := range lines[1:] {
+		var e manifestEntry
+		if err := json.Unmarshal([]byte(l), &e); err != nil {
+			t.Fatalf("bad line %q: %v", l, err)
+		}
+		if e.TweetID == "" || e.Platform != platformX || time.Since(e.PostedAt) > time.Minute {
+			t.Errorf("incomplete entry: %+v", e)
+		}
+		media[e.VerseLabel] = e.MediaCount
+	}
+	if media["1"] != 1 || media["2"] != 0 || len(media) != 2 {
+		t.Errorf("media counts by label = %v, want 1:1 2:0", media)
+	}
+}
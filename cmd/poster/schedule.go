@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// xSchedule says when and as whom to schedule tweets. X only offers
+// scheduling through the Ads API, which needs an ads account.
+type xSchedule struct {
+	At        time.Time
+	AccountID string // ads account, from X_ADS_ACCOUNT_ID
+	UserID    string // the posting user's numeric id (as_user_id)
+}
+
+// check rejects a schedule time that is not in the future; the API would
+// refuse it anyway, after the images had been uploaded.
+func (s xSchedule) check(now time.Time) error {
+	if !s.At.After(now) {
+		return fmt.Errorf("schedule time %s is in the past", s.At.Format(time.RFC3339))
+	}
+	return nil
+}
+
+const xAdsAPIBase = "https://ads-api.x.com/12"
+
+// scheduleTweet creates a scheduled tweet and returns its scheduled-tweet id.
+// The verse should only be marked posted once this succeeds.
+func scheduleTweet(httpClient *http.Client, s xSchedule, text string, mediaIDs []string) (string, error) {
+	form := url.Values{
+		"scheduled_at": {s.At.UTC().Format(time.RFC3339)},
+		"as_user_id":   {s.UserID},
+		"text":         {text},
+	}
+	if len(mediaIDs) > 0 {
+		// Images uploaded through media/upload have media key "3_<id>".
+		keys := make([]string, len(mediaIDs))
+		for i, id := range mediaIDs {
+			keys[i] = "3_" + id
+		}
+		form.Set("media_keys", strings.Join(keys, ","))
+	}
+
+	endpoint := xAdsAPIBase + "/accounts/" + url.PathEscape(s.AccountID) + "/scheduled_tweets"
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return "", httpError(resp, b, "POST /accounts/:id/scheduled_tweets")
+	}
+
+	var r struct {
+		Data struct {
+			ID string `json:"id_str"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	if r.Data.ID == "" {
+		return "", fmt.Errorf("schedule tweet: missing id in response")
+	}
+	return r.Data.ID, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXPoster_Schedule(t *testing.T) {
+	at := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+
+	var path string
+	var form map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		r.ParseForm()
+		form = map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"id_str": "sched-1"}})
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+	p := &xPoster{client: client, schedule: &xSchedule{At: at, AccountID: "acc1", UserID: "42"}}
+	id, err := p.Post(context.Background(), "1: verse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "sched-1" {
+		t.Errorf("expected scheduled id sched-1, got %q", id)
+	}
+	if path != "/12/accounts/acc1/scheduled_tweets" {
+		t.Errorf("unexpected path %s", path)
+	}
+	if form["scheduled_at"] != at.Format(time.RFC3339) || form["text"] != "1: verse" || form["as_user_id"] != "42" {
+		t.Errorf("unexpected form %v", form)
+	}
+}
+
+func TestXPoster_SchedulePastRejected(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+
+	p := &xPoster{client: client, schedule: &xSchedule{At: time.Now().Add(-time.Hour), AccountID: "acc1"}}
+	_, err := p.Post(context.Background(), "1: verse", nil)
+	if err == nil || !strings.Contains(err.Error(), "in the past") {
+		t.Errorf("expected a past-time error, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("expected no API calls for a past time, got %d", calls)
+	}
+}
+
+func TestPostBatch_ScheduledIDKeptApart(t *testing.T) {
+	r := seedTexts(t, 1)
+	r.poster = posterFunc(func(context.Context, string, []string) (string, error) { return "sched-1", nil })
+	r.scheduled, r.chain = true, true
+	r.manifest = filepath.Join(t.TempDir(), "posts.jsonl")
+
+	if _, err := r.postBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var posted, postID sql.NullString
+	r.db.QueryRow(`SELECT posted_at, x_post_id FROM texts WHERE id = 1`).Scan(&posted, &postID)
+	if !posted.Valid || postID.Valid {
+		t.Errorf("posted_at=%v x_post_id=%v, want marked posted without a tweet id", posted, postID)
+	}
+	var scheduledID string
+	r.db.QueryRow(`SELECT post_id FROM post_events WHERE text_id = 1 AND status = ?`, eventScheduled).Scan(&scheduledID)
+	if scheduledID != "sched-1" {
+		t.Errorf("scheduled event post_id = %q, want sched-1", scheduledID)
+	}
+	if v, _ := getKV(context.Background(), r.db, kvLastPostID); v != "" {
+		t.Errorf("the scheduled id became the -chain reply target %q", v)
+	}
+	if _, err := os.Stat(r.manifest); !os.IsNotExist(err) {
+		t.Errorf("expected no manifest entry for a scheduled post, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// checkResult is one line of the selftest checklist. Skipped checks neither
+// pass nor fail.
+type checkResult struct {
+	Name    string
+	Detail  string
+	Err     error
+	Skipped bool
+}
+
+// selftest runs every deployment check short of posting: the database opens
+// and has unposted verses, the credentials work (unless verify is nil) and
+// the images directory exists.
+func selftest(ctx context.Context, open func() (*DB, error), verify func() (string, error), imagesDir string) []checkResult {
+	var out []checkResult
+
+	db, err := open()
+	out = append(out, checkResult{Name: "database", Detail: "opened", Err: err})
+	if err != nil {
+		out = append(out, checkResult{Name: "unposted verses", Skipped: true, Detail: "no database"})
+	} else {
+		defer db.Close()
+		var n int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM {texts} WHERE posted_at IS NULL`).Scan(&n)
+		if err == nil && n == 0 {
+			err = errNoUnposted
+		}
+		out = append(out, checkResult{Name: "unposted verses", Detail: fmt.Sprint(n), Err: err})
+	}
+
+	if verify == nil {
+		out = append(out, checkResult{Name: "credentials", Skipped: true, Detail: "skipped"})
+	} else {
+		who, err := verify()
+		out = append(out, checkResult{Name: "credentials", Detail: who, Err: err})
+	}
+
+	fi, err := os.Stat(imagesDir)
+	if err == nil && !fi.IsDir() {
+		err = errors.New("not a directory")
+	}
+	out = append(out, checkResult{Name: "images dir", Detail: imagesDir, Err: err})
+	return out
+}
+
+// printChecklist writes one line per check and reports whether all passed.
+func printChecklist(w io.Writer, results []checkResult) bool {
+	ok := true
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(w, "- %s: %s\n", r.Name, r.Detail)
+		case r.Err != nil:
+			ok = false
+			fmt.Fprintf(w, "✗ %s: %v\n", r.Name, r.Err)
+		default:
+			fmt.Fprintf(w, "✓ %s: %s\n", r.Name, r.Detail)
+		}
+	}
+	return ok
+}
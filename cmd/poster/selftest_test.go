@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelftest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":"1","name":"Portable Buddha","username":"portablebuddha"}}`))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+	verify := func() (string, error) { return verifyCredentials(client) }
+
+	open := func() (*DB, error) {
+		db := newTestDB(t)
+		db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (1, '1', 'verse')`)
+		return db, nil
+	}
+
+	var out bytes.Buffer
+	if !printChecklist(&out, selftest(context.Background(), open, verify, t.TempDir())) {
+		t.Errorf("expected all checks to pass:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "✓ unposted verses: 1") || !strings.Contains(out.String(), "✓ credentials: portablebuddha") {
+		t.Errorf("unexpected checklist:\n%s", out.String())
+	}
+
+	// A missing images directory fails the run, without hiding other results.
+	out.Reset()
+	missing := filepath.Join(t.TempDir(), "missing")
+	if printChecklist(&out, selftest(context.Background(), open, nil, missing)) {
+		t.Errorf("expected a failing check:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "✗ images dir") || !strings.Contains(out.String(), "- credentials: skipped") {
+		t.Errorf("unexpected checklist:\n%s", out.String())
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// newServer returns the handler for the serve command:
+//
+//	GET /preview  the next post, as the dry-run JSON preview
+//
+// Nothing is posted or marked; each request selects afresh with base's
+// selection and status options.
+func newServer(base *runner) http.Handler {
+	// Requests are served concurrently but share the -seed rng, which is not
+	// safe for concurrent use.
+	var rngMu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /preview", func(w http.ResponseWriter, req *http.Request) {
+		r := *base // next mutates the selector; keep requests independent
+		r.sel.skipIDs = slices.Clone(base.sel.skipIDs)
+		if r.sel.rng != nil {
+			rngMu.Lock()
+			defer rngMu.Unlock()
+		}
+		preview, err := r.dryRun(req.Context(), false)
+		switch {
+		case errors.Is(err, errNoUnposted):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		case err != nil:
+			log.Printf("preview: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "preview failed"})
+		default:
+			writeJSON(w, http.StatusOK, preview)
+		}
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
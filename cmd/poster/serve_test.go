@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServer_Preview(t *testing.T) {
+	r := seedTexts(t, 1)
+	r.db.Exec(`UPDATE texts SET text_body = ? WHERE id = 1`, strings.Repeat("word ", 100))
+	srv := httptest.NewServer(newServer(r))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("got %s, %q", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	var got struct {
+		Label         string   `json:"label"`
+		Status        string   `json:"status"`
+		Length        int      `json:"length"`
+		Images        []string `json:"images"`
+		WouldTruncate *bool    `json:"would_truncate"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Label != "1" || !strings.HasPrefix(got.Status, "1: word") || got.Length != runeLen(got.Status) {
+		t.Errorf("unexpected preview: %+v", got)
+	}
+	if got.Images == nil || len(got.Images) != 0 || got.WouldTruncate == nil || !*got.WouldTruncate {
+		t.Errorf("want images [] and would_truncate true: %+v", got)
+	}
+	var posted int
+	r.db.QueryRow(`SELECT COUNT(*) FROM texts WHERE posted_at IS NOT NULL`).Scan(&posted)
+	if posted != 0 {
+		t.Errorf("a preview marked %d verse(s) posted", posted)
+	}
+
+	// Once nothing is left to post, the preview is a 404.
+	r.db.Exec(`UPDATE texts SET posted_at = CURRENT_TIMESTAMP`)
+	resp, err = http.Get(srv.URL + "/preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("with nothing unposted: got %s, want 404", resp.Status)
+	}
+}
+
+func TestServer_PreviewFollowsPlatform(t *testing.T) {
+	seeded := seedTexts(t, 1)
+	seeded.db.Exec(`UPDATE texts SET text_body = ? WHERE id = 1`, strings.Repeat("word ", 500))
+	os.WriteFile(filepath.Join(seeded.imagesDir, "1.jpg"), fakeJPEG, 0644)
+	for i := 1; i < 5; i++ {
+		os.WriteFile(filepath.Join(seeded.imagesDir, fmt.Sprintf("1-%d.jpg", i)), fakeJPEG, 0644)
+	}
+	for _, tt := range []struct {
+		platform         string
+		images, maxRunes int
+	}{
+		{platformX, xMaxMedia, xMaxLen},
+		{platformDiscord, 5, discordMaxLen},
+	} {
+		cfg := &config{platform: tt.platform, imagesDir: seeded.imagesDir}
+		if err := setupPlatform(cfg); err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(newServer(previewRunner(cfg, seeded.db)))
+		resp, err := http.Get(srv.URL + "/preview")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got dryRunPreview
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Images) != tt.images {
+			t.Errorf("%s: %d images, want %d", tt.platform, len(got.Images), tt.images)
+		}
+		if got.Length > tt.maxRunes || got.Length <= tt.maxRunes-20 {
+			t.Errorf("%s: status is %d runes, want just under %d", tt.platform, got.Length, tt.maxRunes)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// normalizeTag folds a tag to the form stored in the tags table, so "Anger"
+// and " anger" are the same tag.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// addTag tags the verse with the given label; tagging twice is a no-op.
+func addTag(ctx context.Context, db *DB, label, tag string) error {
+	id, err := textIDByLabel(ctx, db, label)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO {tags} (text_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING`, id, normalizeTag(tag))
+	return err
+}
+
+// removeTag removes a tag from the verse with the given label.
+func removeTag(ctx context.Context, db *DB, label, tag string) error {
+	id, err := textIDByLabel(ctx, db, label)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `DELETE FROM {tags} WHERE text_id = ? AND tag = ?`, id, normalizeTag(tag))
+	return err
+}
+
+func textIDByLabel(ctx context.Context, db *DB, label string) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, `SELECT id FROM {texts} WHERE label = ?`, label).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("no verse with label %q", label)
+	}
+	return id, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestTagSelection(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	defer db.Close()
+	for i := 1; i <= 4; i++ {
+		db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (?, ?, ?)`, i, fmt.Sprint(i), fmt.Sprintf("verse %d", i))
+	}
+	for _, label := range []string{"4", "2"} {
+		if err := addTag(ctx, db, label, "Anger"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := addTag(ctx, db, "2", "anger "); err != nil { // same tag again
+		t.Fatal(err)
+	}
+	addTag(ctx, db, "3", "wisdom")
+
+	labels := func(sel selector) string {
+		t.Helper()
+		texts, err := peek(ctx, db, sel, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, txt := range texts {
+			out = append(out, txt.Label)
+		}
+		return fmt.Sprint(out)
+	}
+	if got := labels(selector{order: orderSeq, tag: "anger"}); got != "[2 4]" {
+		t.Errorf("-tag anger -order seq selected %s, want [2 4]", got)
+	}
+
+	if err := removeTag(ctx, db, "2", "ANGER"); err != nil {
+		t.Fatal(err)
+	}
+	if got := labels(selector{order: orderSeq, tag: "anger"}); got != "[4]" {
+		t.Errorf("after remove-tag, selected %s, want [4]", got)
+	}
+	if txt, err := selectText(ctx, db, selector{tag: "anger"}); err != nil || txt.Label != "4" {
+		t.Errorf("random order with -tag anger: %+v, %v", txt, err)
+	}
+
+	if err := addTag(ctx, db, "99", "anger"); err == nil {
+		t.Error("expected tagging an unknown label to fail")
+	}
+}
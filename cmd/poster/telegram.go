@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Telegram limits: captions (photo posts) are capped at 1024 characters, so
+// that is the status budget even for text-only messages; media groups hold
+// up to 10 items.
+const (
+	telegramMaxLen   = 1024
+	telegramMaxMedia = 10
+)
+
+const telegramAPIBase = "https://api.telegram.org"
+
+// telegramPoster posts through the Bot API: sendMessage for text-only
+// verses, sendPhoto for one image and sendMediaGroup for several.
+type telegramPoster struct {
+	client  *http.Client
+	apiBase string // telegramAPIBase, or a test server
+	token   string
+	chatID  string
+	spoiler bool // cover photos with a spoiler animation (-sensitive)
+}
+
+func newTelegramPosterFromEnv() *telegramPoster {
+	p := &telegramPoster{
+		client:  &http.Client{Transport: httpTransport},
+		apiBase: telegramAPIBase,
+		token:   os.Getenv("TELEGRAM_BOT_TOKEN"),
+		chatID:  os.Getenv("TELEGRAM_CHAT_ID"),
+	}
+	for k, v := range map[string]string{
+		"TELEGRAM_BOT_TOKEN": p.token,
+		"TELEGRAM_CHAT_ID":   p.chatID,
+	} {
+		if v == "" {
+			log.Fatalf("missing required env var: %s", k)
+		}
+	}
+	return p
+}
+
+// telegramMessage is the part of a Bot API Message we need.
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+}
+
+func (p *telegramPoster) maxMedia() int { return telegramMaxMedia }
+
+func (p *telegramPoster) Post(ctx context.Context, status string, images []string) (string, error) {
+	if len(images) > telegramMaxMedia {
+		images = images[:telegramMaxMedia]
+	}
+	switch len(images) {
+	case 0:
+		body, err := json.Marshal(map[string]string{"chat_id": p.chatID, "text": status})
+		if err != nil {
+			return "", err
+		}
+		var m telegramMessage
+		if err := p.call(ctx, "sendMessage", "application/json", bytes.NewReader(body), &m); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(m.MessageID, 10), nil
+
+	case 1:
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		if err := w.WriteField("chat_id", p.chatID); err != nil {
+			return "", err
+		}
+		if err := w.WriteField("caption", status); err != nil {
+			return "", err
+		}
+		if err := addFilePart(w, "photo", images[0], filepath.Base(images[0])); err != nil {
+			return "", err
+		}
+		if p.spoiler {
+			if err := w.WriteField("has_spoiler", "true"); err != nil {
+				return "", err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		var m telegramMessage
+		if err := p.call(ctx, "sendPhoto", w.FormDataContentType(), &buf, &m); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(m.MessageID, 10), nil
+	}
+
+	// Several images: one media group, captioned on the first photo.
+	type inputMedia struct {
+		Type       string `json:"type"`
+		Media      string `json:"media"`
+		Caption    string `json:"caption,omitempty"`
+		HasSpoiler bool   `json:"has_spoiler,omitempty"`
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	media := make([]inputMedia, len(images))
+	for i, img := range images {
+		name := fmt.Sprintf("photo%d", i)
+		media[i] = inputMedia{Type: "photo", Media: "attach://" + name, HasSpoiler: p.spoiler}
+		if err := addFilePart(w, name, img, filepath.Base(img)); err != nil {
+			return "", err
+		}
+	}
+	media[0].Caption = status
+	mj, err := json.Marshal(media)
+	if err != nil {
+		return "", err
+	}
+	if err := w.WriteField("chat_id", p.chatID); err != nil {
+		return "", err
+	}
+	if err := w.WriteField("media", string(mj)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	var ms []telegramMessage
+	if err := p.call(ctx, "sendMediaGroup", w.FormDataContentType(), &buf, &ms); err != nil {
+		return "", err
+	}
+	if len(ms) == 0 {
+		return "", fmt.Errorf("telegram sendMediaGroup: no messages in response")
+	}
+	return strconv.FormatInt(ms[0].MessageID, 10), nil
+}
+
+// call invokes a Bot API method and decodes its result into out.
+func (p *telegramPoster) call(ctx context.Context, method, contentType string, body io.Reader, out any) error {
+	// The bot token is part of the URL; keep it out of returned errors.
+	redacted := p.apiBase + "/bot<TELEGRAM_BOT_TOKEN>/" + method
+	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/bot"+p.token+"/"+method, body)
+	if err != nil {
+		return redactURLError(err, redacted)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return redactURLError(err, redacted)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(resp.Body)
+	var r struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil || !r.OK {
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(b),
+			msg:        fmt.Sprintf("telegram %s %d: %s", method, resp.StatusCode, r.Description),
+		}
+	}
+	return json.Unmarshal(r.Result, out)
+}
+
+// redactURLError replaces the URL in a *url.Error, which may embed a secret,
+// with redacted. Other errors are returned as is.
+func redactURLError(err error, redacted string) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return &url.Error{Op: ue.Op, URL: redacted, Err: ue.Err}
+	}
+	return err
+}
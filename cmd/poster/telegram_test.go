@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTelegramPoster_TextOnly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/sendMessage" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["chat_id"] != "@dhammapada" || req["text"] != "1: verse" {
+			t.Errorf("unexpected request %v", req)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":42,"text":"1: verse"}}`))
+	}))
+	defer srv.Close()
+
+	p := &telegramPoster{client: srv.Client(), apiBase: srv.URL, token: "TOKEN", chatID: "@dhammapada"}
+	id, err := p.Post(context.Background(), "1: verse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "42" {
+		t.Errorf("expected message id 42, got %q", id)
+	}
+}
+
+func TestTelegramPoster_SinglePhoto(t *testing.T) {
+	img := filepath.Join(t.TempDir(), "1.jpg")
+	if err := os.WriteFile(img, fakeJPEG, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/sendPhoto" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.FormValue("caption"); got != "1: verse" {
+			t.Errorf("unexpected caption %q", got)
+		}
+		if got := r.FormValue("chat_id"); got != "123" {
+			t.Errorf("unexpected chat_id %q", got)
+		}
+		f, fh, err := r.FormFile("photo")
+		if err != nil {
+			t.Errorf("expected a photo part: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		if fh.Filename != "1.jpg" || string(b) != string(fakeJPEG) {
+			t.Errorf("unexpected photo %s", fh.Filename)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":7}}`))
+	}))
+	defer srv.Close()
+
+	p := &telegramPoster{client: srv.Client(), apiBase: srv.URL, token: "TOKEN", chatID: "123"}
+	id, err := p.Post(context.Background(), "1: verse", []string{img})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "7" {
+		t.Errorf("expected message id 7, got %q", id)
+	}
+}
+
+func TestTelegramPoster_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+	}))
+	defer srv.Close()
+
+	p := &telegramPoster{client: srv.Client(), apiBase: srv.URL, token: "TOKEN", chatID: "123"}
+	_, err := p.Post(context.Background(), "verse", nil)
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("expected the API description in the error, got %v", err)
+	}
+}
+
+func TestTelegramPoster_TransportErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // connections are refused
+
+	p := &telegramPoster{client: srv.Client(), apiBase: srv.URL, token: "123:SECRET", chatID: "@dhammapada"}
+	_, err := p.Post(context.Background(), "1: verse", nil)
+	if err == nil {
+		t.Fatal("expected a transport error")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("error leaks the bot token: %v", err)
+	}
+	if !strings.Contains(err.Error(), "sendMessage") {
+		t.Errorf("error lost the method: %v", err)
+	}
+}
+
+func TestTelegramPoster_Spoiler(t *testing.T) {
+	dir := t.TempDir()
+	var imgs []string
+	for _, name := range []string{"1.jpg", "1-1.jpg"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, fakeJPEG, 0644); err != nil {
+			t.Fatal(err)
+		}
+		imgs = append(imgs, p)
+	}
+
+	var photoSpoiler string
+	var media []struct {
+		HasSpoiler bool `json:"has_spoiler"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botTOKEN/sendPhoto":
+			photoSpoiler = r.FormValue("has_spoiler")
+			w.Write([]byte(`{"ok":true,"result":{"message_id":7}}`))
+		case "/botTOKEN/sendMediaGroup":
+			json.Unmarshal([]byte(r.FormValue("media")), &media)
+			w.Write([]byte(`{"ok":true,"result":[{"message_id":8},{"message_id":9}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := &telegramPoster{client: srv.Client(), apiBase: srv.URL, token: "TOKEN", chatID: "123", spoiler: true}
+	if _, err := p.Post(context.Background(), "1: verse", imgs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if photoSpoiler != "true" {
+		t.Errorf("sendPhoto has_spoiler = %q, want true", photoSpoiler)
+	}
+	if _, err := p.Post(context.Background(), "1: verse", imgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 2 || !media[0].HasSpoiler || !media[1].HasSpoiler {
+		t.Errorf("media group items not marked as spoilers: %+v", media)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "net/http"
+
+const defaultUserAgent = "dhammapada-bot/1.0"
+
+// userAgent is set by -user-agent.
+var userAgent = defaultUserAgent
+
+// httpTransport carries every outbound request (X, Discord, Telegram), so
+// they all identify as userAgent.
+var httpTransport http.RoundTripper = &userAgentTransport{base: http.DefaultTransport}
+
+// userAgentTransport sets the User-Agent header to userAgent, when set, on
+// each request.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if userAgent == "" {
+		return t.base.RoundTrip(req)
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set("User-Agent", userAgent)
+	return t.base.RoundTrip(r)
+}
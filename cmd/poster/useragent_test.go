@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+)
+
+func TestUserAgent_SetOnXRequests(t *testing.T) {
+	old := userAgent
+	defer func() { userAgent = old }()
+	if err := newFlagSet(&config{}).Parse([]string{"-user-agent", "test-agent/2.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		w.Write([]byte(`{"data":{"id":"1","username":"dhammapada"}}`))
+	}))
+	defer srv.Close()
+
+	client := newOAuth1HTTPClient("ck", "cs", "at", "as")
+	ot := client.Transport.(*oauth1.Transport)
+	if ot.Base != httpTransport {
+		t.Fatalf("OAuth1 client does not use httpTransport: %T", ot.Base)
+	}
+	ot.Base = &userAgentTransport{base: rewriteTransport{base: http.DefaultTransport, target: srv.URL}}
+	if _, err := verifyCredentials(client); err != nil {
+		t.Fatal(err)
+	}
+	if got != "test-agent/2.0" {
+		t.Errorf("User-Agent = %q, want test-agent/2.0", got)
+	}
+}
+
+func TestUserAgent_Default(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: httpTransport}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != defaultUserAgent {
+		t.Errorf("User-Agent = %q, want %q", got, defaultUserAgent)
+	}
+}
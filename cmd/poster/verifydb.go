@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// dbCheck is one verify-db query: each row it returns is a problem, described
+// by format applied to the row's columns. Checks needing optional columns or
+// tables the database lacks are skipped.
+type dbCheck struct {
+	query  string
+	format string
+	needs  []string
+}
+
+// dbChecks are the integrity checks run by verify-db. Constraints in
+// create.sql rule most of these out, but databases built by hand or imported
+// elsewhere (e.g. into Postgres) may lack them.
+var dbChecks = []dbCheck{
+	{`SELECT id FROM {texts} WHERE label IS NULL OR TRIM(label) = ''`,
+		"texts id=%v: missing label", nil},
+	{`SELECT id, label FROM {texts} WHERE text_body IS NULL OR TRIM(text_body) = ''`,
+		"texts id=%v (label=%v): missing text_body", nil},
+	{`SELECT label, COUNT(*) FROM {texts} WHERE label IS NOT NULL GROUP BY label HAVING COUNT(*) > 1`,
+		"texts label=%v: used by %v rows", nil},
+	{`SELECT id, label, translator_id FROM {texts}
+WHERE translator_id IS NOT NULL AND translator_id NOT IN (SELECT id FROM {translators})`,
+		"texts id=%v (label=%v): translator_id=%v has no translators row", []string{"translator_id", "translators"}},
+	{`SELECT DISTINCT text_id, tag FROM {tags} WHERE text_id NOT IN (SELECT id FROM {texts})`,
+		"tags text_id=%v (tag=%v): no such text", []string{"tags"}},
+	{`SELECT DISTINCT text_id FROM {posted_hashes} WHERE text_id NOT IN (SELECT id FROM {texts})`,
+		"posted_hashes text_id=%v: no such text", []string{"posted_hashes"}},
+	{`SELECT DISTINCT text_id FROM {post_events} WHERE text_id NOT IN (SELECT id FROM {texts})`,
+		"post_events text_id=%v: no such text", []string{"post_events"}},
+}
+
+// verifyDB runs dbChecks, returning every problem found.
+func verifyDB(ctx context.Context, db *DB) ([]string, error) {
+	var problems []string
+	for _, c := range dbChecks {
+		if slices.ContainsFunc(c.needs, func(n string) bool { return !db.has(n) }) {
+			continue
+		}
+		rows, err := db.QueryContext(ctx, c.query)
+		if err != nil {
+			return nil, err
+		}
+		cols, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		for rows.Next() {
+			vals := make([]any, len(cols))
+			ptrs := make([]any, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			for i, v := range vals {
+				if b, ok := v.([]byte); ok {
+					vals[i] = string(b)
+				}
+			}
+			problems = append(problems, fmt.Sprintf(c.format, vals...))
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return problems, nil
+}
+
+// printDBProblems lists problems, or reports a clean database.
+func printDBProblems(w io.Writer, problems []string) {
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "verify-db: no problems found")
+		return
+	}
+	for _, p := range problems {
+		fmt.Fprintln(w, "✗", p)
+	}
+	fmt.Fprintf(w, "verify-db: %d problem(s)\n", len(problems))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDB_Clean(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	db.Exec(`INSERT INTO texts (id, label, text_body) VALUES (1, '1', 'Mind precedes all.')`)
+	db.Exec(`INSERT INTO tags (text_id, tag) VALUES (1, 'mind')`)
+
+	problems, err := verifyDB(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems, got %q", problems)
+	}
+	var buf bytes.Buffer
+	printDBProblems(&buf, problems)
+	if !strings.Contains(buf.String(), "no problems") {
+		t.Errorf("unexpected report: %q", buf.String())
+	}
+}
+
+func TestVerifyDB_ReportsEachViolation(t *testing.T) {
+	// A texts table without the constraints of create.sql, as a hand-built
+	// or imported database might have.
+	sqldb, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{DB: sqldb, driver: driverSQLite}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE texts (id INTEGER PRIMARY KEY, label TEXT, text_body TEXT, posted_at TEXT, x_post_id TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureSchema(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		`INSERT INTO texts (id, label, text_body) VALUES (1, NULL, 'no label')`,
+		`INSERT INTO texts (id, label, text_body) VALUES (2, '2', '  ')`,
+		`INSERT INTO texts (id, label, text_body) VALUES (3, '3', 'first')`,
+		`INSERT INTO texts (id, label, text_body) VALUES (4, '3', 'second')`,
+		`INSERT INTO texts (id, label, text_body, translator_id) VALUES (5, '5', 'body', 9)`,
+		`INSERT INTO tags (text_id, tag) VALUES (42, 'anger')`,
+		`INSERT INTO posted_hashes (hash, text_id, posted_at) VALUES ('h', 43, CURRENT_TIMESTAMP)`,
+		`INSERT INTO post_events (text_id, status, body, created_at) VALUES (44, 'dry_run', 'x', CURRENT_TIMESTAMP)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	problems, err := verifyDB(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"texts id=1: missing label",
+		"texts id=2 (label=2): missing text_body",
+		"texts label=3: used by 2 rows",
+		"texts id=5 (label=5): translator_id=9 has no translators row",
+		"tags text_id=42 (tag=anger): no such text",
+		"posted_hashes text_id=43: no such text",
+		"post_events text_id=44: no such text",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
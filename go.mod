@@ -4,6 +4,7 @@ go 1.23.0
 
 require (
 	github.com/dghubble/oauth1 v0.7.3
+	github.com/lib/pq v1.12.3
 	modernc.org/sqlite v1.38.2
 )
 
@@ -5,6 +5,48 @@ CREATE TABLE texts (
   id         INTEGER PRIMARY KEY,
   label      TEXT NOT NULL UNIQUE,
   text_body  TEXT NOT NULL,
+  pali       TEXT NULL,
+  chapter    TEXT NULL,
+  translator_id INTEGER NULL,  -- translators.id; NULL means translator 1
   posted_at  TEXT NULL,
   x_post_id  TEXT NULL
 );
+
+-- SHA-256 of each posted body, so -no-repeat can catch reposts across
+-- database copies and resets
+CREATE TABLE posted_hashes (
+  hash       TEXT PRIMARY KEY,
+  text_id    INTEGER NOT NULL,
+  posted_at  TEXT NOT NULL
+);
+
+-- small key/value store for run state, e.g. the last post id for -chain
+CREATE TABLE kv (
+  key        TEXT PRIMARY KEY,
+  value      TEXT NOT NULL
+);
+
+-- audit trail of post attempts, e.g. dry runs recorded with -record-dry-run
+CREATE TABLE post_events (
+  text_id    INTEGER NOT NULL,
+  status     TEXT NOT NULL,
+  body       TEXT NOT NULL,
+  post_id    TEXT NULL,
+  created_at TEXT NOT NULL
+);
+
+-- translations and the attribution each one's posts carry
+CREATE TABLE translators (
+  id          INTEGER PRIMARY KEY,
+  name        TEXT NOT NULL,
+  attribution TEXT NOT NULL
+);
+INSERT INTO translators (id, name, attribution)
+VALUES (1, 'F Max Müller', 'Dhammapada (F Max Müller)');
+
+-- themes for curated series, e.g. "anger"; see -tag and add-tag
+CREATE TABLE tags (
+  text_id    INTEGER NOT NULL,
+  tag        TEXT NOT NULL,
+  PRIMARY KEY (text_id, tag)
+);
@@ -1,21 +1,37 @@
 package model
 
 type Text struct {
-	ID     int64
-	Label  string   // eg: "151" or "58–59"
-	Body   string   // verse text
-	Images []string // 0..n filesystem paths (we'll cap to 4 on post)
+	ID      int64
+	Label   string   // eg: "151" or "58–59"
+	Body    string   // verse text
+	Pali    string   // original Pāli, if known
+	Chapter string   // chapter name, if known, eg: "Twin Verses"
+	Images  []string // 0..n filesystem paths (we'll cap to 4 on post)
+
+	// Attribution credits the verse's translation, from its translator
+	// record, eg: "Dhammapada (F Max Müller)"; empty means the default.
+	Attribution string
 }
 
 // --- v2 create tweet ---
 
 type TweetReq struct {
-	Text  string      `json:"text"`
-	Media *TweetMedia `json:"media,omitempty"`
+	Text         string      `json:"text"`
+	Media        *TweetMedia `json:"media,omitempty"`
+	Reply        *TweetReply `json:"reply,omitempty"`
+	QuoteTweetID string      `json:"quote_tweet_id,omitempty"`
+	Poll         *TweetPoll  `json:"poll,omitempty"`
 }
 type TweetMedia struct {
 	MediaIDs []string `json:"media_ids"`
 }
+type TweetReply struct {
+	InReplyToTweetID string `json:"in_reply_to_tweet_id"`
+}
+type TweetPoll struct {
+	Options         []string `json:"options"`
+	DurationMinutes int      `json:"duration_minutes"`
+}
 type TweetResp struct {
 	Data struct {
 		ID   string `json:"id"`
@@ -23,9 +39,30 @@ type TweetResp struct {
 	} `json:"data"`
 }
 
+// --- v2 users/me ---
+
+type UserResp struct {
+	Data struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Username string `json:"username"`
+	} `json:"data"`
+}
+
 // --- v1.1 media/upload (simple upload) ---
 
 type MediaUploadResp struct {
 	MediaID       int64  `json:"media_id"`
 	MediaIDString string `json:"media_id_string"`
 }
+
+// --- v1.1 media/metadata/create ---
+
+type MediaMetadataReq struct {
+	MediaID               string        `json:"media_id"`
+	AltText               *MediaAltText `json:"alt_text,omitempty"`
+	SensitiveMediaWarning []string      `json:"sensitive_media_warning,omitempty"`
+}
+type MediaAltText struct {
+	Text string `json:"text"`
+}